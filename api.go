@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// api serves the loaded catalog as read-only JSON
+type api struct {
+	db    *sql.DB
+	terms termCalendar // optional
+}
+
+// apiCourse is a course with its sections, EX: /courses/COMS4118
+type apiCourse struct {
+	Course string
+	Course2
+	Sections []apiSection
+}
+
+// apiSection is a section along with the course it belongs to
+type apiSection struct {
+	Course string
+	Section
+}
+
+// apiInstructor is an instructor with the sections they have taught
+type apiInstructor struct {
+	ID        int64
+	Name      string
+	Canonical string
+	Sections  []apiSection
+}
+
+// page wraps a list of results with its pagination
+type page struct {
+	Items  interface{}
+	Limit  int
+	Offset int
+}
+
+func (a *api) routes() http.Handler {
+	rest := http.NewServeMux()
+	rest.HandleFunc("/courses/", a.getCourse)
+	rest.HandleFunc("/sections", a.listSections)
+	rest.HandleFunc("/instructors/", a.getInstructor)
+	rest.HandleFunc("/search", a.search)
+	rest.HandleFunc("/calendar.ics", a.calendar)
+	rest.HandleFunc("/terms/current", a.currentTerm)
+
+	// GraphQL queries are POSTed, but the schema has no mutations
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", a.graphql())
+	mux.Handle("/", readOnly(rest))
+	return mux
+}
+
+// readOnly() rejects every method but GET and HEAD
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON() encodes 'v' with an ETag, answering 304 when the client already
+// has the same representation
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// apiError() logs unexpected errors and hides them from the client
+func apiError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Error serving %s => %s", r.URL.Path, err.Error())
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// pagination() reads the 'limit' and 'offset' query parameters
+func pagination(r *http.Request) (limit, offset int, err error) {
+	limit, offset = defaultPageSize, 0
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	if s := r.URL.Query().Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a positive number")
+		}
+	}
+	return limit, offset, nil
+}
+
+// the sections_v2_t columns read into an apiSection
+var sectionColumns = `
+	S.course,
+	S.term,
+	S.callnumber,
+	coalesce(S.campuscode, ''),
+	coalesce(S.campusname, ''),
+	coalesce(S.numenrolled, 0),
+	coalesce(S.maxsize, 0),
+	coalesce(S.typecode, ''),
+	coalesce(S.typename, ''),
+	coalesce(S.meets1, ''),
+	coalesce(S.meets2, ''),
+	coalesce(S.meets3, ''),
+	coalesce(S.meets4, ''),
+	coalesce(S.meets5, ''),
+	coalesce(S.meets6, ''),
+	coalesce(S.instructor1name, ''),
+	coalesce(S.instructor2name, ''),
+	coalesce(S.instructor3name, ''),
+	coalesce(S.instructor4name, ''),
+	coalesce(S.exammeet, ''),
+	coalesce(S.examdate, '')`
+
+// scanSection() reads sectionColumns followed by any 'extra' columns
+func scanSection(rows *sql.Rows, extra ...interface{}) (apiSection, error) {
+	var s apiSection
+	dest := []interface{}{
+		&s.Course,
+		&s.Term,
+		&s.CallNumber,
+		&s.CampusCode,
+		&s.CampusName,
+		&s.NumEnrolled,
+		&s.MaxSize,
+		&s.TypeCode,
+		&s.TypeName,
+		&s.Meets1,
+		&s.Meets2,
+		&s.Meets3,
+		&s.Meets4,
+		&s.Meets5,
+		&s.Meets6,
+		&s.Instructor1Name,
+		&s.Instructor2Name,
+		&s.Instructor3Name,
+		&s.Instructor4Name,
+		&s.ExamMeet,
+		&s.ExamDate,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return s, err
+	}
+
+	// the parsed meeting fields are derived the same way as during a load
+	s.fillMeetings()
+	return s, nil
+}
+
+// querySections() runs a query selecting sectionColumns
+func (a *api) querySections(ctx context.Context, query string, args ...interface{}) ([]apiSection, error) {
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := []apiSection{}
+	for rows.Next() {
+		s, err := scanSection(rows)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+	return sections, rows.Err()
+}
+
+// the courses_v2_t columns read into an apiCourse
+var courseColumns = `
+	course,
+	coalesce(coursefull, ''),
+	coalesce(prefixname, ''),
+	coalesce(divisioncode, ''),
+	coalesce(divisionname, ''),
+	coalesce(schoolcode, ''),
+	coalesce(schoolname, ''),
+	coalesce(departmentcode, ''),
+	coalesce(departmentname, ''),
+	coalesce(subtermcode, ''),
+	coalesce(subtermname, ''),
+	coalesce(enrollmentstatus, ''),
+	coalesce(numfixedunits, 0),
+	coalesce(minunits, 0),
+	coalesce(maxunits, 0),
+	coalesce(coursetitle, ''),
+	coalesce(coursesubtitle, ''),
+	coalesce(approval, ''),
+	coalesce(bulletinflags, ''),
+	coalesce(classnotes, ''),
+	coalesce(prefixlongname, ''),
+	coalesce(description, '')`
+
+// rowScanner is either a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCourse(row rowScanner) (apiCourse, error) {
+	var c apiCourse
+	err := row.Scan(
+		&c.Course,
+		&c.CourseFull,
+		&c.PrefixName,
+		&c.DivisionCode,
+		&c.DivisionName,
+		&c.SchoolCode,
+		&c.SchoolName,
+		&c.DepartmentCode,
+		&c.DepartmentName,
+		&c.SubtermCode,
+		&c.SubtermName,
+		&c.EnrollmentStatus,
+		&c.NumFixedUnits,
+		&c.MinUnits,
+		&c.MaxUnits,
+		&c.CourseTitle,
+		&c.CourseSubtitle,
+		&c.Approval,
+		&c.BulletinFlags,
+		&c.ClassNotes,
+		&c.PrefixLongname,
+		&c.Description,
+	)
+	return c, err
+}
+
+// GET /courses/{course}
+func (a *api) getCourse(w http.ResponseWriter, r *http.Request) {
+	course := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/courses/"))
+	if course == "" || strings.Contains(course, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	c, err := scanCourse(a.db.QueryRowContext(r.Context(), `SELECT `+courseColumns+` FROM courses_v2_t WHERE course = $1`, course))
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+
+	c.Sections, err = a.querySections(r.Context(),
+		`SELECT `+sectionColumns+` FROM sections_v2_t S WHERE S.course = $1 AND S.cancelled_at IS NULL ORDER BY S.term DESC, S.callnumber`,
+		course,
+	)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	writeJSON(w, r, c)
+}
+
+// GET /sections?term=&dept=
+func (a *api) listSections(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	term := r.URL.Query().Get("term")
+	dept := strings.ToUpper(r.URL.Query().Get("dept"))
+
+	sections, err := a.querySections(r.Context(),
+		`SELECT `+sectionColumns+`
+		 FROM sections_v2_t S JOIN courses_v2_t C
+		 ON C.course = S.course
+		 WHERE S.cancelled_at IS NULL
+			AND ($1 = '' OR S.term = $1)
+			AND ($2 = '' OR C.departmentcode = $2)
+		 ORDER BY S.term DESC, S.course, S.callnumber
+		 LIMIT $3 OFFSET $4`,
+		term, dept, limit, offset,
+	)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	writeJSON(w, r, page{Items: sections, Limit: limit, Offset: offset})
+}
+
+// GET /instructors/{id}
+func (a *api) getInstructor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/instructors/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var i apiInstructor
+	err = a.db.QueryRowContext(r.Context(),
+		`SELECT id, name, canonical FROM instructors_t WHERE id = $1`, id,
+	).Scan(&i.ID, &i.Name, &i.Canonical)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+
+	i.Sections, err = a.querySections(r.Context(),
+		`SELECT `+sectionColumns+`
+		 FROM sections_v2_t S JOIN section_instructors_t SI
+		 ON SI.term = S.term AND SI.callnumber = S.callnumber
+		 WHERE SI.instructor_id = $1 AND S.cancelled_at IS NULL
+		 ORDER BY S.term DESC, S.course, S.callnumber`,
+		id,
+	)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	writeJSON(w, r, i)
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, so they match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// searchMatchQuery selects a page of the courses whose code, title or
+// description, or the name of an instructor of a section that is not
+// cancelled, matches $1, so only those are aggregated into documents
+var searchMatchQuery = `
+SELECT C.course
+ FROM courses_v2_t C
+ WHERE EXISTS (SELECT 1 FROM sections_v2_t S WHERE S.course = C.course AND S.cancelled_at IS NULL)
+	AND (C.course ILIKE $1 || '%'
+	OR C.coursetitle ILIKE '%' || $1 || '%'
+	OR C.description ILIKE '%' || $1 || '%'
+	OR EXISTS (
+		SELECT 1
+		 FROM sections_v2_t S JOIN section_instructors_t SI
+		 ON SI.term = S.term AND SI.callnumber = S.callnumber
+		 JOIN instructors_t I
+		 ON I.id = SI.instructor_id
+		 WHERE S.course = C.course AND S.cancelled_at IS NULL AND I.name ILIKE '%' || $1 || '%'))
+ ORDER BY C.course
+ LIMIT $2 OFFSET $3
+`
+
+// GET /search?q=, matches the same documents that are indexed in ES
+func (a *api) search(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "q must be set", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := a.db.QueryContext(r.Context(),
+		`WITH matched AS (`+searchMatchQuery+`)`+esDataQuery(`C.course IN (SELECT course FROM matched)`)+`
+		 ORDER BY C.course`,
+		likeEscaper.Replace(q), limit, offset,
+	)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	results := []esData{}
+	for rows.Next() {
+		data, err := scanEsData(rows)
+		if err != nil {
+			apiError(w, r, err)
+			return
+		}
+		results = append(results, data)
+	}
+	if err := rows.Err(); err != nil {
+		apiError(w, r, err)
+		return
+	}
+	writeJSON(w, r, page{Items: results, Limit: limit, Offset: offset})
+}
+
+// apiTerm is a term with its dates from the term calendar
+type apiTerm struct {
+	Term     string
+	Name     string   // EX: Fall 2014
+	Start    string   `json:",omitempty"`
+	End      string   `json:",omitempty"`
+	Holidays []string `json:",omitempty"`
+}
+
+func (a *api) describeTerm(code string) (apiTerm, error) {
+	t, err := ParseTerm(code)
+	if err != nil {
+		return apiTerm{}, err
+	}
+	desc := apiTerm{Term: t.Code(), Name: t.String()}
+	if dates, ok := a.terms[code]; ok {
+		desc.Start = dates.Start.Format("2006-01-02")
+		desc.End = dates.End.Format("2006-01-02")
+		for _, h := range dates.Holidays {
+			desc.Holidays = append(desc.Holidays, h.Format("2006-01-02"))
+		}
+	}
+	return desc, nil
+}
+
+// GET /terms/current
+func (a *api) currentTerm(w http.ResponseWriter, r *http.Request) {
+	code, ok := a.terms.current(time.Now())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	t, err := a.describeTerm(code)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	writeJSON(w, r, t)
+}
+
+// serveCmd() serves the read-only API until the command is interrupted
+func serveCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "Address to serve the API on")
+	skipAuth := flags.Bool("skip-auth", false, "Serve without requiring an API token")
+	rate := flags.Float64("rate", 5, "Requests per second allowed for each API token")
+	burst := flags.Int("burst", 20, "Requests an API token may burst up to")
+	calendarFile := flags.String("calendar", "", "Term calendar with the dates of each term")
+	flags.Parse(args)
+	if *rate <= 0 || *burst < 1 {
+		return fmt.Errorf("-rate must be positive and -burst at least 1")
+	}
+
+	a := &api{}
+	if *calendarFile != "" {
+		var err error
+		if a.terms, err = loadTermCalendar(*calendarFile); err != nil {
+			return err
+		}
+	}
+
+	db := connectPG()
+	defer db.Close()
+	a.db = db
+
+	handler := a.routes()
+	if !*skipAuth {
+		if err := checkTokensMigrated(ctx, db); err != nil {
+			return err
+		}
+		handler = newTokenAuth(db, newRateLimiter(*rate, *burst)).wrap(handler)
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving the API on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWriteJSONETag(t *testing.T) {
+	v := page{Items: []string{"COMS4118"}, Limit: 1}
+
+	rec := httptest.NewRecorder()
+	writeJSON(rec, httptest.NewRequest("GET", "/sections", nil), v)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected a 200 with an ETag, found %d %q", rec.Code, etag)
+	}
+	if body := rec.Body.String(); body != `{"Items":["COMS4118"],"Limit":1,"Offset":0}` {
+		t.Errorf("Unexpected body, %s", body)
+	}
+
+	req := httptest.NewRequest("GET", "/sections", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	writeJSON(rec, req, v)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected a bodiless 304 for a matching ETag, found %d", rec.Code)
+	}
+}
+
+var paginationInputs = map[string]bool{ // query --> valid
+	"":                    true,
+	"?limit=10":           true,
+	"?limit=10&offset=20": true,
+	"?limit=0":            false,
+	"?limit=100000":       false,
+	"?offset=-1":          false,
+	"?limit=ten":          false,
+}
+
+func TestPagination(t *testing.T) {
+	for query, valid := range paginationInputs {
+		limit, offset, err := pagination(httptest.NewRequest("GET", "/sections"+query, nil))
+		if (err == nil) != valid {
+			t.Errorf("Expected %q to be valid: %t, found %v", query, valid, err)
+		}
+		if query == "?limit=10&offset=20" && (limit != 10 || offset != 20) {
+			t.Errorf("Expected limit 10 offset 20, found %d %d", limit, offset)
+		}
+	}
+	if limit, _, _ := pagination(httptest.NewRequest("GET", "/sections", nil)); limit != defaultPageSize {
+		t.Errorf("Expected the default page size, found %d", limit)
+	}
+}
+
+// newAPIMock() is an api over a mocked Postgres
+func newAPIMock(t *testing.T) (*api, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &api{db: db}, mock
+}
+
+// serveAPI() serves a GET of 'path' with the api's routes
+func serveAPI(a *api, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+func TestGetCourse(t *testing.T) {
+	a, mock := newAPIMock(t)
+	mock.ExpectQuery(`FROM courses_v2_t WHERE course = \$1`).WithArgs("COMS4118").WillReturnError(sql.ErrNoRows)
+	if rec := serveAPI(a, "/courses/coms4118"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a 404 for a missing course, found %d", rec.Code)
+	}
+	if rec := serveAPI(a, "/courses/COMS4118/sections"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a 404 for a nested path, found %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetInstructor(t *testing.T) {
+	a, mock := newAPIMock(t)
+	mock.ExpectQuery(`SELECT id, name, canonical FROM instructors_t WHERE id = \$1`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "canonical"}).AddRow(7, "John N Vitucci", "VITUCCI, JOHN N"))
+	mock.ExpectQuery(`WHERE SI.instructor_id = \$1 AND S.cancelled_at IS NULL`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	rec := serveAPI(a, "/instructors/7")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected a 200, found %d %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); body != `{"ID":7,"Name":"John N Vitucci","Canonical":"VITUCCI, JOHN N","Sections":[]}` {
+		t.Errorf("Unexpected body, %s", body)
+	}
+	if rec := serveAPI(a, "/instructors/vitucci"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a 404 for a non-numeric id, found %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+var searchInputs = map[string]string{ // q --> pattern argument
+	"COMS":      "COMS",
+	"100%":      `100\%`,
+	"intro_to":  `intro\_to`,
+	`back\path`: `back\\path`,
+}
+
+func TestSearch(t *testing.T) {
+	a, mock := newAPIMock(t)
+	if rec := serveAPI(a, "/search"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a 400 without q, found %d", rec.Code)
+	}
+
+	for q, pattern := range searchInputs {
+		// the page of matching courses is selected before any are aggregated
+		mock.ExpectQuery(`WITH matched AS \(\s+SELECT C.course\s+FROM courses_v2_t C .* LIMIT \$2 OFFSET \$3\s+\)`+
+			`.* WHERE S.cancelled_at IS NULL AND C.course IN \(SELECT course FROM matched\)\s+GROUP BY`).
+			WithArgs(pattern, defaultPageSize, 0).
+			WillReturnRows(sqlmock.NewRows(nil))
+		rec := serveAPI(a, "/search?q="+url.QueryEscape(q))
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"Items":[],"Limit":50,"Offset":0}` {
+			t.Errorf("Expected no results for %q, found %d %s", q, rec.Code, rec.Body.String())
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
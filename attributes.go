@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/natebrennand/dataupdates/coursecode"
+)
+
+// courseAttribute is a curated list of courses, stored as a boolean column of
+// 'courses_add_info'
+type courseAttribute struct {
+	Column string // EX: globalcore
+	Flag   string // the flag naming the list's file
+	Usage  string
+}
+
+var courseAttributes = []courseAttribute{
+	{Column: "globalcore", Flag: "globalcore", Usage: "List of Global Core courses"},
+	{Column: "corecurriculum", Flag: "core", Usage: "List of Core Curriculum courses"},
+	{Column: "writingintensive", Flag: "writing", Usage: "List of writing-intensive courses"},
+	{Column: "labscience", Flag: "lab", Usage: "List of lab science courses"},
+}
+
+// readCourseList() reads a curated list with a CourseFull per line, EX:
+// COMSW4118 or ARTV1010. Blank lines and lines starting with '#' are ignored,
+// and invalid courses are logged and skipped. Courses are returned as the
+// loader writes their CourseFull, so "ART_V1010" is read as ARTV1010.
+func readCourseList(r io.Reader) ([]string, error) {
+	var courses []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		code, err := coursecode.ParseCourse(text)
+		if err != nil {
+			log.Printf("skipping line %d, %q is not a course such as COMSW4118", line, scanner.Text())
+			continue
+		}
+		course := code.Full()
+		if !seen[course] {
+			seen[course] = true
+			courses = append(courses, course)
+		}
+	}
+	return courses, scanner.Err()
+}
+
+// setCourseAttribute() makes the list the only courses with the attribute
+func setCourseAttribute(ctx context.Context, tx *sql.Tx, column string, courses []string) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE courses_add_info SET %s = false`, column))
+	if err != nil {
+		return fmt.Errorf("Failed to clear courses_add_info.%s => %s", column, err.Error())
+	}
+
+	query := fmt.Sprintf(`INSERT INTO courses_add_info (coursefull, %[1]s) VALUES ($1, true)
+	 ON CONFLICT (coursefull) DO UPDATE SET %[1]s = true`, column)
+	for _, course := range courses {
+		if _, err := tx.ExecContext(ctx, query, course); err != nil {
+			return fmt.Errorf("Failed to set courses_add_info.%s for %s => %s", column, course, err.Error())
+		}
+	}
+	return nil
+}
+
+// attributesCmd() imports the curated attribute lists into 'courses_add_info'.
+// Each list given replaces its attribute; the others are left alone.
+func attributesCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("attributes", flag.ExitOnError)
+	files := make(map[string]*string)
+	for _, a := range courseAttributes {
+		files[a.Column] = flags.String(a.Flag, "", a.Usage)
+	}
+	skipES := flags.Bool("skip-es", false, "Skip running the ES index updates")
+	flags.Parse(args)
+
+	lists := make(map[string][]string)
+	for _, a := range courseAttributes {
+		filename := *files[a.Column]
+		if filename == "" {
+			continue
+		}
+		file, err := os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("Failed to open file, %s, with error: %s", filename, err.Error())
+		}
+		courses, err := readCourseList(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to read %s => %s", filename, err.Error())
+		}
+		lists[a.Column] = courses
+	}
+	if len(lists) == 0 {
+		return fmt.Errorf("at least one of -globalcore, -core, -writing or -lab must be set")
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+	for _, a := range courseAttributes {
+		if courses, ok := lists[a.Column]; ok {
+			if err := setCourseAttribute(ctx, tx, a.Column, courses); err != nil {
+				return err
+			}
+			log.Printf("Set %s on %d courses", a.Column, len(courses))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit course attributes => %s", err.Error())
+	}
+
+	if *skipES {
+		return nil
+	}
+	return updateES(ctx, db, nil)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCourseList(t *testing.T) {
+	input := `# Global Core, Fall 2014
+COMSW4118
+ ahisw3500
+
+AHIS W3500
+ARTV1010
+ART_V1010
+not a course
+`
+	courses, err := readCourseList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"COMSW4118", "AHISW3500", "ARTV1010"}
+	if !reflect.DeepEqual(courses, expected) {
+		t.Errorf("Expected %v, found %v", expected, courses)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// newToken() generates a random API token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token => %s", err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// tokenHash() is what users_t.token stores, so a leaked table does not leak
+// usable tokens. It is truncated to fit the varchar(32) column. Tokens stored
+// before they were hashed are hashed by migrateTokens().
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// requestToken() reads the token from "Authorization: Bearer <token>" or the
+// 'token' query parameter
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// bucket is a token bucket of requests
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter allows each key 'rate' requests per second with bursts of up to 'burst'
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// allow() takes a request from the key's bucket, returning false and how long
+// to wait when it is empty
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// tokenAuth checks API tokens against users_t and rate limits each user
+type tokenAuth struct {
+	lookup  func(ctx context.Context, hash string) (email string, err error)
+	limiter *rateLimiter
+}
+
+func newTokenAuth(db *sql.DB, limiter *rateLimiter) *tokenAuth {
+	return &tokenAuth{
+		lookup: func(ctx context.Context, hash string) (string, error) {
+			var email string
+			err := db.QueryRowContext(ctx, `SELECT email FROM users_t WHERE token = $1`, hash).Scan(&email)
+			return email, err
+		},
+		limiter: limiter,
+	}
+}
+
+func (a *tokenAuth) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing API token", http.StatusUnauthorized)
+			return
+		}
+
+		email, err := a.lookup(r.Context(), tokenHash(token))
+		if err == sql.ErrNoRows {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			apiError(w, r, err)
+			return
+		}
+
+		if ok, wait := a.limiter.allow(email, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// the changes to users_t for hashed tokens, safe to run more than once. A
+// revoked token is NULL, and token_hashed tells a hash from a token stored in
+// plaintext, as both are 32 hex characters.
+var tokenMigrations = []string{
+	`ALTER TABLE users_t ALTER COLUMN token DROP NOT NULL`,
+	`ALTER TABLE users_t ADD COLUMN IF NOT EXISTS token_hashed boolean DEFAULT false NOT NULL`,
+}
+
+// migrateTokens() replaces each plaintext token in users_t with its hash, so
+// the tokens issued before they were hashed keep working. It returns how many
+// tokens were hashed.
+func migrateTokens(ctx context.Context, db *sql.DB) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	for _, query := range tokenMigrations {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return 0, fmt.Errorf("Failed to migrate users_t => %s", err.Error())
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT email, token FROM users_t WHERE NOT token_hashed AND token IS NOT NULL`)
+	if err != nil {
+		return 0, fmt.Errorf("Error while querying plaintext tokens => %s", err.Error())
+	}
+	plaintext := make(map[string]string) // email --> token
+	for rows.Next() {
+		var email, token string
+		if err := rows.Scan(&email, &token); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("Error while processing plaintext tokens => %s", err.Error())
+		}
+		plaintext[email] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for email, token := range plaintext {
+		_, err := tx.ExecContext(ctx, `UPDATE users_t SET token = $1, token_hashed = true WHERE email = $2`, tokenHash(token), email)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to hash token of %s => %s", email, err.Error())
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Failed to commit hashed tokens => %s", err.Error())
+	}
+	return len(plaintext), nil
+}
+
+// checkTokensMigrated() fails unless migrateTokens() has run over users_t, as
+// the tokens of a database that has not been migrated are never matched
+func checkTokensMigrated(ctx context.Context, db *sql.DB) error {
+	var migrated bool
+	err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'users_t' AND column_name = 'token_hashed')`,
+	).Scan(&migrated)
+	if err != nil {
+		return fmt.Errorf("Failed to read the columns of users_t => %s", err.Error())
+	}
+	if !migrated {
+		return fmt.Errorf("users_t has no token_hashed column, run 'dataupdates tokens migrate' before serving")
+	}
+
+	var plaintext int
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM users_t WHERE NOT token_hashed AND token IS NOT NULL`).Scan(&plaintext)
+	if err != nil {
+		return fmt.Errorf("Error while querying plaintext tokens => %s", err.Error())
+	}
+	if plaintext > 0 {
+		return fmt.Errorf("users_t has %d plaintext tokens, run 'dataupdates tokens migrate' before serving", plaintext)
+	}
+	return nil
+}
+
+// tokensCmd() issues, lists, revokes and migrates API tokens
+func tokensCmd(ctx context.Context, args []string) error {
+	usage := fmt.Errorf("usage: tokens issue -email EMAIL -name NAME | tokens list | tokens revoke -email EMAIL | tokens migrate")
+	if len(args) == 0 {
+		return usage
+	}
+
+	flags := flag.NewFlagSet("tokens "+args[0], flag.ExitOnError)
+	email := flags.String("email", "", "Email of the token's owner")
+	name := flags.String("name", "", "Name of the token's owner")
+	flags.Parse(args[1:])
+
+	db := connectPG()
+	defer db.Close()
+
+	switch args[0] {
+	case "issue":
+		if *email == "" || *name == "" {
+			return fmt.Errorf("-email and -name must be set")
+		}
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		// issuing to an existing email replaces their token
+		_, err = db.ExecContext(ctx,
+			`INSERT INTO users_t (email, token, token_hashed, name) VALUES ($1, $2, true, $3)
+			 ON CONFLICT (email) DO UPDATE SET token = EXCLUDED.token, token_hashed = true, name = EXCLUDED.name`,
+			*email, tokenHash(token), *name,
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to issue token for %s => %s", *email, err.Error())
+		}
+		fmt.Println(token)
+		return nil
+
+	case "list":
+		rows, err := db.QueryContext(ctx, `SELECT email, name, token IS NULL FROM users_t ORDER BY email`)
+		if err != nil {
+			return fmt.Errorf("Error while querying users => %s", err.Error())
+		}
+		defer rows.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "EMAIL\tNAME\tTOKEN")
+		for rows.Next() {
+			var e, n string
+			var revoked bool
+			if err := rows.Scan(&e, &n, &revoked); err != nil {
+				return fmt.Errorf("Error while processing users => %s", err.Error())
+			}
+			status := "active"
+			if revoked {
+				status = "revoked"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e, n, status)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return w.Flush()
+
+	case "revoke":
+		if *email == "" {
+			return fmt.Errorf("-email must be set")
+		}
+		// the user is kept, and can be issued a new token
+		res, err := db.ExecContext(ctx, `UPDATE users_t SET token = NULL WHERE email = $1 AND token IS NOT NULL`, *email)
+		if err != nil {
+			return fmt.Errorf("Failed to revoke token for %s => %s", *email, err.Error())
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("no token issued to %s", *email)
+		}
+		return nil
+
+	case "migrate":
+		n, err := migrateTokens(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("hashed %d plaintext tokens\n", n)
+		return nil
+	}
+	return usage
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	if ok, wait := l.allow("a", now); ok || wait != time.Second {
+		t.Errorf("Expected the third request to wait a second, found %t %s", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("Expected each key to have its own bucket")
+	}
+	if ok, _ := l.allow("a", now.Add(time.Second)); !ok {
+		t.Error("Expected the bucket to refill")
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	valid := "0123456789abcdef0123456789abcdef"
+	auth := &tokenAuth{
+		lookup: func(ctx context.Context, hash string) (string, error) {
+			if hash != tokenHash(valid) {
+				return "", sql.ErrNoRows
+			}
+			return "adi@columbia.edu", nil
+		},
+		limiter: newRateLimiter(1, 1),
+	}
+	handler := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	requests := []struct {
+		header, query string
+		code          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"Bearer nope", "", http.StatusUnauthorized},
+		{"Bearer " + valid, "", http.StatusOK},
+		{"", "?token=" + valid, http.StatusTooManyRequests}, // same user, burst of 1
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest("GET", "/sections"+req.query, nil)
+		if req.header != "" {
+			r.Header.Set("Authorization", req.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != req.code {
+			t.Errorf("Expected %d for %q %q, found %d", req.code, req.header, req.query, rec.Code)
+		}
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	token, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 32 || len(tokenHash(token)) != 32 || tokenHash(token) == token {
+		t.Errorf("Expected a 32 character token and hash, found %s %s", token, tokenHash(token))
+	}
+}
+
+func TestMigrateTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	plaintext := "0123456789abcdef0123456789abcdef"
+	mock.ExpectBegin()
+	for range tokenMigrations {
+		mock.ExpectExec(`ALTER TABLE users_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery(`SELECT email, token FROM users_t WHERE NOT token_hashed AND token IS NOT NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "token"}).AddRow("adi@columbia.edu", plaintext))
+	mock.ExpectExec(`UPDATE users_t SET token = \$1, token_hashed = true WHERE email = \$2`).
+		WithArgs(tokenHash(plaintext), "adi@columbia.edu").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := migrateTokens(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Failed to migrate tokens => %s", err.Error())
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 token to be hashed, found %d", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckTokensMigrated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	column := `SELECT EXISTS \(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\(\) AND table_name = 'users_t' AND column_name = 'token_hashed'\)`
+	plaintext := `SELECT count\(\*\) FROM users_t WHERE NOT token_hashed AND token IS NOT NULL`
+	mock.ExpectQuery(column).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(column).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(plaintext).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(column).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(plaintext).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	for _, expected := range []string{"no token_hashed column", "2 plaintext tokens"} {
+		err := checkTokensMigrated(context.Background(), db)
+		if err == nil || !strings.Contains(err.Error(), expected) || !strings.Contains(err.Error(), "dataupdates tokens migrate") {
+			t.Errorf("Expected an error naming %q and the migration, found %v", expected, err)
+		}
+	}
+	if err := checkTokensMigrated(context.Background(), db); err != nil {
+		t.Errorf("Expected a migrated users_t to pass, found %s", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServeRejectsRate(t *testing.T) {
+	for _, args := range [][]string{{"-rate", "0"}, {"-rate", "-1"}, {"-burst", "0"}} {
+		if err := serveCmd(context.Background(), args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
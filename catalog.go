@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// sqliteCatalogTables are created in a SQLite catalog beside the course store
+// tables, with the same columns as their Postgres tables
+var sqliteCatalogTables = []string{
+	`CREATE TABLE IF NOT EXISTS instructors_t (
+	 id INTEGER PRIMARY KEY,
+	 name TEXT NOT NULL,
+	 canonical TEXT NOT NULL UNIQUE,
+	 lastname TEXT NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS instructors_t_lastname_idx ON instructors_t (substr(lastname, 1, 3))`,
+	`CREATE TABLE IF NOT EXISTS section_instructors_t (
+	 term TEXT NOT NULL,
+	 callnumber INTEGER NOT NULL,
+	 instructor_id INTEGER NOT NULL REFERENCES instructors_t (id),
+	 position INTEGER NOT NULL,
+	 PRIMARY KEY (term, callnumber, instructor_id))`,
+	`CREATE TABLE IF NOT EXISTS section_meetings_t (
+	 term TEXT NOT NULL,
+	 callnumber INTEGER NOT NULL,
+	 slot INTEGER NOT NULL,
+	 weekday TEXT NOT NULL,
+	 starttime TEXT,
+	 endtime TEXT,
+	 building TEXT,
+	 room TEXT,
+	 PRIMARY KEY (term, callnumber, slot, weekday))`,
+	`CREATE TABLE IF NOT EXISTS prerequisites_t (
+	 course TEXT PRIMARY KEY,
+	 text TEXT NOT NULL,
+	 expression TEXT)`,
+	`CREATE TABLE IF NOT EXISTS cross_listings_t (
+	 course TEXT NOT NULL,
+	 crosslisted TEXT NOT NULL,
+	 PRIMARY KEY (course, crosslisted))`,
+	// searches the title and description of each course in courses_v2_t,
+	// which it reads its rows from
+	`CREATE VIRTUAL TABLE IF NOT EXISTS courses_fts USING fts5 (
+	 course UNINDEXED,
+	 coursetitle,
+	 coursesubtitle,
+	 description,
+	 content = 'courses_v2_t')`,
+}
+
+// sqliteHasFTS5() reports whether the SQLite driver was built with FTS5,
+// which go-sqlite3 needs the 'sqlite_fts5' build tag for
+func sqliteHasFTS5(ctx context.Context, db *sql.DB) (bool, error) {
+	var used bool
+	err := db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("Failed to read SQLite compile options => %s", err.Error())
+	}
+	return used, nil
+}
+
+// newSQLiteCatalog() creates the tables of an offline catalog in 'db'
+func newSQLiteCatalog(ctx context.Context, db *sql.DB) (*sqliteCourseStore, error) {
+	if ok, err := sqliteHasFTS5(ctx, db); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("SQLite was built without FTS5, build with '-tags sqlite_fts5'")
+	}
+
+	store, err := newSQLiteCourseStore(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range sqliteCatalogTables {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("Failed to create SQLite catalog table => %s", err.Error())
+		}
+	}
+	return store, nil
+}
+
+// writeSQLiteCatalog() runs the course pipeline over 'filename' without
+// Postgres or ES, writing the catalog to a new SQLite file, 'out':
+// parse --> scrape descriptions --> insert to SQLite --> extract requisites.
+// The catalog is written beside 'out' and only replaces it once complete.
+func writeSQLiteCatalog(ctx context.Context, filename, out string, opts loadOptions) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to open file, %s, with error: %s", filename, err.Error())
+	}
+	defer file.Close()
+
+	tmp := out + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove %s => %s", tmp, err.Error())
+	}
+	defer os.Remove(tmp)
+
+	db, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return fmt.Errorf("Failed to open SQLite catalog, %s => %s", tmp, err.Error())
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // SQLite allows a single writer
+
+	store, err := newSQLiteCatalog(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	instructors := newInstructorStore(db, sqliteInstructorCandidatesQuery)
+	courseChan := make(chan Course)
+	describedChan := make(chan Course, 50)
+
+	stats := opts.Stats
+	opts.SnapshotEnrollment = false // the catalog has no enrollment history
+	seen := make(sectionSet)
+	g.Go(func() error {
+		return stats.stage("parse", func() error { return parseCourses(gctx, file, courseChan, stats) })
+	})
+	g.Go(func() error {
+		return stats.stage("scrape", func() error { return scrapeDescriptions(gctx, courseChan, describedChan, stats) })
+	})
+	g.Go(func() error {
+		return stats.stage("insert", func() error { return dbWorker(gctx, db, store, instructors, describedChan, opts, seen) })
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if err := stats.stage("requisites", func() error { return updateRequisites(ctx, db) }); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `INSERT INTO courses_fts (courses_fts) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("Failed to build the course search index => %s", err.Error())
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("Failed to close SQLite catalog, %s => %s", tmp, err.Error())
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return fmt.Errorf("Failed to move SQLite catalog to %s => %s", out, err.Error())
+	}
+	slog.Info("wrote SQLite catalog", "file", out, "terms", seen.terms())
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSQLiteCatalog(t *testing.T) {
+	mem, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mem.Close()
+	if ok, err := sqliteHasFTS5(context.Background(), mem); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Skip("SQLite was built without FTS5, run with '-tags sqlite_fts5'")
+	}
+
+	bulletin, _ := startFakes(t)
+	out := filepath.Join(t.TempDir(), "catalog.db")
+
+	stats := newRunStats(testStarted)
+	err = writeSQLiteCatalog(context.Background(), e2eDoc, out, loadOptions{StartedAt: testStarted, Stats: stats})
+	if err != nil {
+		t.Fatalf("Failed to write the catalog => %s", err.Error())
+	}
+	if len(bulletin.requests) != 2 {
+		t.Errorf("Expected a bulletin request per course, found %v", bulletin.requests)
+	}
+	if stats.get(insertedSections) != 2 {
+		t.Errorf("Expected 2 inserted sections, found %d", stats.get(insertedSections))
+	}
+
+	db, err := sql.Open("sqlite3", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	counts := map[string]int{
+		"courses_t":             2,
+		"courses_v2_t":          2,
+		"course_terms_t":        2,
+		"sections_v2_t":         2,
+		"instructors_t":         2, // John N Vitucci and Lisa Minetti
+		"section_instructors_t": 3,
+	}
+	for table, expected := range counts {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatalf("Failed to count %s => %s", table, err.Error())
+		}
+		if n != expected {
+			t.Errorf("Expected %d rows in %s, found %d", expected, table, n)
+		}
+	}
+
+	var meetings int
+	if err := db.QueryRow(`SELECT count(*) FROM section_meetings_t WHERE term = '20143'`).Scan(&meetings); err != nil {
+		t.Fatal(err)
+	}
+	if meetings == 0 {
+		t.Error("Expected the sections' meetings to be stored")
+	}
+
+	// descriptions scraped from the bulletin are searchable
+	var course string
+	err = db.QueryRow(`SELECT course FROM courses_fts WHERE courses_fts MATCH 'workshop'`).Scan(&course)
+	if err != nil {
+		t.Fatalf("Failed to search the catalog => %s", err.Error())
+	}
+	if course != "ACTU4850" {
+		t.Errorf("Expected a search of the descriptions to find ACTU4850, found %s", course)
+	}
+	err = db.QueryRow(`SELECT course FROM courses_fts WHERE courses_fts MATCH 'coursetitle:pensions'`).Scan(&course)
+	if err != nil || course != "ACTU4620" {
+		t.Errorf("Expected a search of the titles to find ACTU4620, found %s (%v)", course, err)
+	}
+}
+
+func TestSQLiteInstructorCandidatesIndex(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, query := range sqliteCatalogTables {
+		if strings.Contains(query, "VIRTUAL TABLE") { // needs FTS5, and is not used here
+			continue
+		}
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("Failed to create catalog table => %s", err.Error())
+		}
+	}
+
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+sqliteInstructorCandidatesQuery, "VITUCCI")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	if p := strings.Join(plan, "; "); !strings.Contains(p, "instructors_t_lastname_idx") {
+		t.Errorf("Expected the instructor lookup to use instructors_t_lastname_idx, found %s", p)
+	}
+}
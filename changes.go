@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kinds of changeEvent
+const (
+	eventSeatOpened        = "seat_opened"
+	eventSectionCancelled  = "section_cancelled"
+	eventTimeChanged       = "time_changed"
+	eventRoomChanged       = "room_changed"
+	eventInstructorChanged = "instructor_changed"
+)
+
+var (
+	cancelledStatus = "X" // EnrollmentStatus of a cancelled section
+	// EnrollmentStatus of a section taking a waitlist. Like cancelledStatus it
+	// is not defined by the feed's fixtures or any documentation kept here, so
+	// check it against a current export before relying on the counts.
+	waitlistedStatus = "W"
+	webhookClient    = &http.Client{Timeout: 30 * time.Second}
+	webhookBatch     = 100
+)
+
+// changeEvent describes one change to a section between two loads
+type changeEvent struct {
+	ID         int64 `json:",omitempty"`
+	Kind       string
+	Term       string
+	CallNumber string
+	Course     string
+	Old        string
+	New        string
+	CreatedAt  time.Time
+}
+
+// the time, room and instructor details of a section, formatted for comparison.
+// Times and rooms cover every one of the section's meetings, EX:
+// "1 TR 10:10:00-11:25:00; 3 F 20:10:00-22:00:00"
+func sectionTimes(c Course) string {
+	var meetings []string
+	for _, m := range c.Meetings {
+		meetings = append(meetings, fmt.Sprintf("%d %s %s-%s", m.Slot, m.MeetsOn, m.StartTime, m.EndTime))
+	}
+	return strings.Join(meetings, "; ")
+}
+
+func sectionRooms(c Course) string {
+	var meetings []string
+	for _, m := range c.Meetings {
+		meetings = append(meetings, strings.TrimSpace(fmt.Sprintf("%d %s %s", m.Slot, m.Building, m.Room)))
+	}
+	return strings.Join(meetings, "; ")
+}
+
+func sectionInstructors(c Course) string {
+	var names []string
+	for _, name := range []string{c.Instructor1Name, c.Instructor2Name, c.Instructor3Name, c.Instructor4Name} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "; ")
+}
+
+// whether every seat in the section is taken
+func isFull(c Course) bool {
+	enrolled, _ := strconv.Atoi(c.NumEnrolled)
+	max, _ := strconv.Atoi(c.MaxSize)
+	return max > 0 && enrolled >= max
+}
+
+// diffSections() lists the changes between the previously loaded state of a
+// section, 'old', and the state found in this load, 'new'
+func diffSections(old, new Course) []changeEvent {
+	var events []changeEvent
+	add := func(kind, o, n string) {
+		events = append(events, changeEvent{
+			Kind:       kind,
+			Term:       new.Term,
+			CallNumber: new.CallNumber,
+			Course:     new.ShortCourse,
+			Old:        o,
+			New:        n,
+		})
+	}
+
+	if new.EnrollmentStatus == cancelledStatus {
+		if old.EnrollmentStatus != cancelledStatus {
+			add(eventSectionCancelled, old.EnrollmentStatus, new.EnrollmentStatus)
+		}
+		return events // nothing else about a cancelled section matters
+	}
+
+	if isFull(old) && !isFull(new) {
+		add(eventSeatOpened, old.NumEnrolled+"/"+old.MaxSize, new.NumEnrolled+"/"+new.MaxSize)
+	}
+	if o, n := sectionTimes(old), sectionTimes(new); o != n {
+		add(eventTimeChanged, o, n)
+	}
+	if o, n := sectionRooms(old), sectionRooms(new); o != n {
+		add(eventRoomChanged, o, n)
+	}
+	if o, n := sectionInstructors(old), sectionInstructors(new); o != n {
+		add(eventInstructorChanged, o, n)
+	}
+	return events
+}
+
+var previousSectionQuery = `
+SELECT
+	coalesce(numenrolled, 0),
+	coalesce(maxsize, 0),
+	coalesce(enrollmentstatus, ''),
+	coalesce(meets1, ''),
+	coalesce(meets2, ''),
+	coalesce(meets3, ''),
+	coalesce(meets4, ''),
+	coalesce(meets5, ''),
+	coalesce(meets6, ''),
+	coalesce(instructor1name, ''),
+	coalesce(instructor2name, ''),
+	coalesce(instructor3name, ''),
+	coalesce(instructor4name, '')
+ FROM sections_v2_t
+ WHERE term = $1 AND callnumber = $2;
+`
+
+// previousSection() loads the section as it was stored by an earlier load.
+// 'found' is false for sections that have not been loaded before.
+func previousSection(ctx context.Context, db *sql.DB, c Course) (prev Course, found bool, err error) {
+	err = db.QueryRowContext(ctx, previousSectionQuery, c.Term, c.CallNumber).Scan(
+		&prev.NumEnrolled,
+		&prev.MaxSize,
+		&prev.EnrollmentStatus,
+		&prev.Meets1,
+		&prev.Meets2,
+		&prev.Meets3,
+		&prev.Meets4,
+		&prev.Meets5,
+		&prev.Meets6,
+		&prev.Instructor1Name,
+		&prev.Instructor2Name,
+		&prev.Instructor3Name,
+		&prev.Instructor4Name,
+	)
+	if err == sql.ErrNoRows {
+		return prev, false, nil
+	} else if err != nil {
+		return prev, false, fmt.Errorf("Failed to query previous section, %s %s => %s", c.Term, c.CallNumber, err.Error())
+	}
+	prev.Term, prev.CallNumber, prev.ShortCourse = c.Term, c.CallNumber, c.ShortCourse
+	prev.fillMeetings()
+	return prev, true, nil
+}
+
+// Insert writes the event to the 'change_events_t' outbox
+func (e changeEvent) Insert(ctx context.Context, db execer) error {
+	query := `INSERT INTO change_events_t (
+	kind,
+	term,
+	callnumber,
+	course,
+	old,
+	new
+	) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+	)`
+	_, err := db.ExecContext(ctx, query, e.Kind, e.Term, e.CallNumber, e.Course, e.Old, e.New)
+	if err != nil {
+		return fmt.Errorf("Failed to insert change_events_t, %#v, => %s", e, err.Error())
+	}
+	return nil
+}
+
+// detectChanges() compares each course read from 'in' against the section
+// stored by the previous load, writes any changes to the outbox, then passes
+// the course on to 'out'. It must run before the section is upserted.
+// 'out' is always closed on return.
+func detectChanges(ctx context.Context, db *sql.DB, in <-chan Course, out chan<- Course, stats *runStats) error {
+	defer close(out)
+
+	for c := range in {
+		prev, found, err := previousSection(ctx, db, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Warn("could not detect changes", "course", c.Course, "err", err.Error())
+		} else if found {
+			for _, e := range diffSections(prev, c) {
+				if err := e.Insert(ctx, db); err != nil {
+					slog.Warn("failed to record change", "kind", e.Kind, "course", c.Course, "err", err.Error())
+					continue
+				}
+				stats.add(changeEvents, 1)
+			}
+		}
+
+		select {
+		case out <- c:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+var pendingEventsQuery = `
+SELECT id, kind, term, callnumber, course, old, new, created_at
+ FROM change_events_t
+ WHERE delivered_at IS NULL
+ ORDER BY id
+ LIMIT $1;
+`
+
+// postEvents() sends a batch of events to the webhook as a JSON array
+func postEvents(ctx context.Context, url string, events []changeEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal change events => %s", err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Failed to form webhook request => %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failure posting change events => %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Problem posting change events => status code = %d, %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// deliverEvents() posts every undelivered event in the outbox to the webhook,
+// marking each batch delivered once the webhook accepts it
+func deliverEvents(ctx context.Context, db *sql.DB, url string) error {
+	for {
+		rows, err := db.QueryContext(ctx, pendingEventsQuery, webhookBatch)
+		if err != nil {
+			return fmt.Errorf("Error while querying change events => %s", err.Error())
+		}
+
+		var events []changeEvent
+		var ids []string
+		for rows.Next() {
+			var e changeEvent
+			if err := rows.Scan(&e.ID, &e.Kind, &e.Term, &e.CallNumber, &e.Course, &e.Old, &e.New, &e.CreatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("Error while processing change events => %s", err.Error())
+			}
+			events = append(events, e)
+			ids = append(ids, strconv.FormatInt(e.ID, 10))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("Error while reading change events => %s", err.Error())
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		if err := postEvents(ctx, url, events); err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx,
+			`UPDATE change_events_t SET delivered_at = now() WHERE id = ANY($1::bigint[])`,
+			"{"+strings.Join(ids, ",")+"}",
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to mark change events delivered => %s", err.Error())
+		}
+		slog.Info("delivered change events", "events", len(events))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testSection = Course{
+	Course2: Course2{EnrollmentStatus: "C"},
+	Section: Section{
+		Term:            "20143",
+		CallNumber:      "13704",
+		NumEnrolled:     "30",
+		MaxSize:         "30",
+		MeetsOn1:        "M",
+		StartTime1:      "20:10:00",
+		EndTime1:        "22:00:00",
+		Building1:       "MATHEMATICS",
+		Room1:           "207",
+		Meets1:          meetsString("M", "08:10P", "10:00P", "MATHEMATICS", "207"),
+		Instructor1Name: "VITUCCI, JOHN N",
+		Meetings:        []Meeting{{Slot: 1, MeetsOn: "M", StartTime: "20:10:00", EndTime: "22:00:00", Building: "MATHEMATICS", Room: "207"}},
+	},
+	ShortCourse: "ACTU4850",
+}
+
+func TestDiffSections(t *testing.T) {
+	if events := diffSections(testSection, testSection); len(events) != 0 {
+		t.Errorf("Expected no events for an unchanged section, found %#v", events)
+	}
+
+	changed := testSection
+	changed.NumEnrolled = "29"
+	changed.Meetings = []Meeting{{Slot: 1, MeetsOn: "M", StartTime: "19:10:00", EndTime: "22:00:00", Building: "MATHEMATICS", Room: "307"}}
+	changed.Instructor2Name = "MINETTI, LISA"
+
+	expected := map[string]bool{
+		eventSeatOpened:        true,
+		eventRoomChanged:       true,
+		eventTimeChanged:       true,
+		eventInstructorChanged: true,
+	}
+	events := diffSections(testSection, changed)
+	if len(events) != len(expected) {
+		t.Errorf("Expected %d events, found %#v", len(expected), events)
+	}
+	for _, e := range events {
+		if !expected[e.Kind] {
+			t.Errorf("Unexpected event, %s", e.Kind)
+		}
+		if e.Term != "20143" || e.CallNumber != "13704" || e.Course != "ACTU4850" {
+			t.Errorf("Event not keyed to the section => %#v", e)
+		}
+	}
+
+	cancelled := changed
+	cancelled.EnrollmentStatus = cancelledStatus
+	events = diffSections(testSection, cancelled)
+	if len(events) != 1 || events[0].Kind != eventSectionCancelled {
+		t.Errorf("Expected only a cancellation event, found %#v", events)
+	}
+}
+
+func TestDiffSectionsLaterMeetings(t *testing.T) {
+	old := testSection
+	old.Meets3 = meetsString("F", "10:10A", "11:25A", "HAMILTON", "503")
+	old.fillMeetings()
+
+	// only the third meeting moves, to a later time and another room
+	changed := old
+	changed.Meets3 = meetsString("F", "01:10P", "02:25P", "HAMILTON", "602")
+	changed.fillMeetings()
+
+	events := diffSections(old, changed)
+	if len(events) != 2 || events[0].Kind != eventTimeChanged || events[1].Kind != eventRoomChanged {
+		t.Fatalf("Expected the third meeting's time and room to change, found %#v", events)
+	}
+	if events[0].Old != "1 M 20:10:00-22:00:00; 3 F 10:10:00-11:25:00" || events[0].New != "1 M 20:10:00-22:00:00; 3 F 13:10:00-14:25:00" {
+		t.Errorf("Expected every meeting's times, found %q => %q", events[0].Old, events[0].New)
+	}
+	if events[1].New != "1 MATHEMATICS 207; 3 HAMILTON 602" {
+		t.Errorf("Expected every meeting's room, found %q", events[1].New)
+	}
+}
+
+func TestPostEvents(t *testing.T) {
+	var received []changeEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON webhook, found %s", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode webhook body => %s", err.Error())
+		}
+	}))
+	defer receiver.Close()
+
+	events := diffSections(testSection, Course{Section: Section{Term: "20143", CallNumber: "13704"}})
+	if err := postEvents(context.Background(), receiver.URL, events); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != len(events) {
+		t.Fatalf("Expected %d events to be delivered, found %d", len(events), len(received))
+	}
+	for i := range events {
+		if received[i].Kind != events[i].Kind || received[i].New != events[i].New {
+			t.Errorf("Event not delivered as sent, %#v != %#v", received[i], events[i])
+		}
+	}
+}
+
+func TestPostEventsRejected(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	if err := postEvents(context.Background(), receiver.URL, []changeEvent{{Kind: eventSeatOpened}}); err == nil {
+		t.Error("Expected an error when the webhook rejects the events")
+	}
+}
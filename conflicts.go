@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/natebrennand/dataupdates/schedule"
+)
+
+// layouts ExamDate may be given in
+var examDateLayouts = []string{"01/02/2006", "1/2/2006", "2006-01-02", "20060102"}
+
+// parseExam() reads a section's exam, nil if it has none
+func parseExam(examMeet, examDate string) *schedule.Exam {
+	var exam schedule.Exam
+	for _, layout := range examDateLayouts {
+		if d, err := time.Parse(layout, strings.TrimSpace(examDate)); err == nil {
+			exam.Date = d
+			break
+		}
+	}
+	if exam.Date.IsZero() {
+		return nil
+	}
+
+	// ExamMeet shares the fixed width layout of MeetsN
+	if examMeet != "" {
+		m := parseMeeting(0, examMeet)
+		exam.Start, _ = schedule.ParseClock(m.StartTime)
+		exam.End, _ = schedule.ParseClock(m.EndTime)
+	}
+	return &exam
+}
+
+var scheduleSectionsQuery = `
+SELECT
+	S.callnumber,
+	S.course,
+	coalesce(S.exammeet, ''),
+	coalesce(S.examdate, ''),
+	coalesce(M.slot, 0),
+	coalesce(M.weekday, ''),
+	coalesce(M.starttime::text, ''),
+	coalesce(M.endtime::text, '')
+ FROM sections_v2_t S LEFT JOIN section_meetings_t M
+ ON M.term = S.term AND M.callnumber = S.callnumber
+ WHERE S.term = $1
+	AND S.cancelled_at IS NULL
+	AND (S.callnumber = ANY($2::integer[]) OR S.course = ANY($3::text[]))
+ ORDER BY S.course, S.callnumber, M.slot;
+`
+
+// loadScheduleSections() loads the sections of a term with the given call
+// numbers, or belonging to the given courses, in course order
+func loadScheduleSections(ctx context.Context, db *sql.DB, term string, callNumbers, courses []string) ([]schedule.Section, error) {
+	rows, err := db.QueryContext(ctx, scheduleSectionsQuery,
+		term,
+		"{"+strings.Join(callNumbers, ",")+"}",
+		"{"+strings.Join(courses, ",")+"}",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying sections => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var sections []schedule.Section
+	var slots map[int]int // slot --> index in the current section's Meetings
+	for rows.Next() {
+		var (
+			callNumber, course, examMeet, examDate string
+			slot                                   int
+			weekday, start, end                    string
+		)
+		if err := rows.Scan(&callNumber, &course, &examMeet, &examDate, &slot, &weekday, &start, &end); err != nil {
+			return nil, fmt.Errorf("Error while processing sections => %s", err.Error())
+		}
+
+		// rows of a section are adjacent, one per meeting weekday
+		if len(sections) == 0 || sections[len(sections)-1].CallNumber != callNumber {
+			sections = append(sections, schedule.Section{
+				CallNumber: callNumber,
+				Course:     course,
+				Exam:       parseExam(examMeet, examDate),
+			})
+			slots = make(map[int]int)
+		}
+		s := &sections[len(sections)-1]
+		if weekday == "" {
+			continue // no meetings
+		}
+
+		i, ok := slots[slot]
+		if !ok {
+			startClock, _ := schedule.ParseClock(start)
+			endClock, _ := schedule.ParseClock(end)
+			s.Meetings = append(s.Meetings, schedule.Meeting{Start: startClock, End: endClock})
+			i = len(s.Meetings) - 1
+			slots[slot] = i
+		}
+		s.Meetings[i].Weekdays = append(s.Meetings[i].Weekdays, weekdayLetters[rune(weekday[0])])
+	}
+	return sections, rows.Err()
+}
+
+// splits a comma separated flag
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToUpper(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// conflictsCmd() prints the conflicts between sections, or the conflict-free
+// schedules for a list of courses
+func conflictsCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	term := flags.String("term", "", "Term of the sections, EX: 20143")
+	calls := flags.String("calls", "", "Comma separated call numbers to check for conflicts")
+	courses := flags.String("courses", "", "Comma separated courses to find conflict-free schedules for, EX: COMS4118,COMS4111")
+	limit := flags.Int("limit", 50, "Most schedules to list")
+	flags.Parse(args)
+	if *term == "" {
+		return fmt.Errorf("-term must be set")
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	if *calls != "" {
+		sections, err := loadScheduleSections(ctx, db, *term, splitList(*calls), nil)
+		if err != nil {
+			return err
+		}
+		for _, c := range schedule.Conflicts(sections) {
+			if c.Kind == schedule.ExamConflict {
+				fmt.Printf("%s\t%s\t%s\t%s\n", c.Kind, c.A, c.B, c.Date.Format("2006-01-02"))
+			} else {
+				fmt.Printf("%s\t%s\t%s\t%s\n", c.Kind, c.A, c.B, c.Day)
+			}
+		}
+	}
+
+	if *courses != "" {
+		wanted := splitList(*courses)
+		sections, err := loadScheduleSections(ctx, db, *term, nil, wanted)
+		if err != nil {
+			return err
+		}
+
+		// one list of options per course, in the order asked for
+		byCourse := make(map[string][]schedule.Section)
+		for _, s := range sections {
+			byCourse[s.Course] = append(byCourse[s.Course], s)
+		}
+		var options [][]schedule.Section
+		for _, course := range wanted {
+			if len(byCourse[course]) == 0 {
+				return fmt.Errorf("no sections of %s in %s", course, *term)
+			}
+			options = append(options, byCourse[course])
+		}
+
+		for _, combo := range schedule.Combinations(options, *limit) {
+			var callNumbers []string
+			for _, s := range combo {
+				callNumbers = append(callNumbers, s.CallNumber)
+			}
+			fmt.Println(strings.Join(callNumbers, ","))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExam(t *testing.T) {
+	exam := parseExam(meetsString("M", "01:10P", "04:00P", "HAMILTON", "503"), "12/15/2014")
+	if exam == nil {
+		t.Fatal("Expected an exam")
+	}
+	if !exam.Date.Equal(time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the exam on 2014-12-15, found %s", exam.Date)
+	}
+	if exam.Start.String() != "13:10" || exam.End.String() != "16:00" {
+		t.Errorf("Expected the exam from 13:10 to 16:00, found %s to %s", exam.Start, exam.End)
+	}
+
+	if exam := parseExam("", ""); exam != nil {
+		t.Errorf("Expected no exam without a date, found %#v", exam)
+	}
+}
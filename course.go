@@ -1,22 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/kennygrant/sanitize"
+	"github.com/natebrennand/dataupdates/coursecode"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
-	httpSemaphore = make(chan int, MaxHTTPRequests)                 // used to limit the # of HTTP requests at a time
-	re            = regexp.MustCompile(`(\w{4})(\w{4})(\w)(\w{3})`) // EXAMPLE:  COMS4995W001 => [COMS, 4995, W, 001]
-	tags          = regexp.MustCompile(`(?s:<.+?>)`)                // meant to match all HTML tags
+	bulletinURL    = "http://www.columbia.edu/cu/bulletin/uwb/" // root of the bulletin's section pages
+	bulletinClient = &http.Client{Timeout: 30 * time.Second}    // keeps a stalled bulletin from hanging the load
+	tags           = regexp.MustCompile(`(?s:<.+?>)`)           // meant to match all HTML tags
 	// TODO: repent for this hidiousness
 	desc = regexp.MustCompile(`[.\n]*Course Description</td>\n <td bgcolor=#DADADA>(?s:.*)<tr valign=top><td bgcolor=#99CCFF>Web Site</td>[.\n]*`)
 
@@ -53,39 +57,19 @@ func zeroInt(s string) string {
 	return strconv.FormatInt(int64(n), 10)
 }
 
-// helper method for fill()
+// helper method for fill(), times are given as "08:10P" or "10:10A"
 func parseDate(t string) string {
-	if tm, err := time.Parse("15:04P", t); err == nil {
+	if tm, err := time.Parse("03:04PM", t+"M"); err == nil {
+		return tm.Format("15:04:05")
+	} else if tm, err := time.Parse("15:04", t); err == nil {
 		return tm.Format("15:04:05")
 	}
 	return "00:00:00"
 }
 
 // standardizes information in a Course
-func (c *Course) fill() {
-	if c.Meets1 == "" {
-		c.StartTime1 = "00:00:00"
-		c.EndTime1 = "00:00:00"
-	} else {
-		s := c.Meets1
-		c.MeetsOn1 = meetsOn.parse(s)
-		c.StartTime1 = parseDate(startTime.parse(s))
-		c.EndTime1 = parseDate(endTime.parse(s))
-		c.Building1 = building.parse(s)
-		c.Room1 = room.parse(s)
-	}
-
-	if c.Meets2 == "" {
-		c.StartTime2 = "00:00:00"
-		c.EndTime2 = "00:00:00"
-	} else {
-		s := c.Meets2
-		c.MeetsOn2 = meetsOn.parse(s)
-		c.StartTime2 = parseDate(startTime.parse(s))
-		c.EndTime2 = parseDate(endTime.parse(s))
-		c.Building2 = building.parse(s)
-		c.Room2 = room.parse(s)
-	}
+func (c *Course) fill() error {
+	c.fillMeetings()
 
 	c.NumFixedUnits = zeroInt(c.NumFixedUnits)
 	c.MinUnits = zeroInt(c.MinUnits)
@@ -94,33 +78,45 @@ func (c *Course) fill() {
 	c.NumEnrolled = zeroInt(c.NumEnrolled)
 	c.MaxSize = zeroInt(c.MaxSize)
 
-	c.setCourseFull()
+	if err := c.setCourseFull(); err != nil {
+		return err
+	}
 	c.setBulletinURL()
+	return nil
 }
 
 // parses the 'CourseFull' attribute
-func (c *Course) setCourseFull() {
-	res := re.FindStringSubmatch(strings.Replace(c.Course, " ", "_", 6))
-	if len(res) != 5 {
-		log.Printf("Failed to parse given 'Course', %s. found %#v", c.Course, res)
+func (c *Course) setCourseFull() error {
+	code, err := coursecode.Parse(c.Course)
+	if err != nil {
+		return err
 	}
 
 	// set up the "Course Full"
-	dept, deptNum, symbol := res[1], res[2], res[3]
-	c.CourseFull = dept + symbol + deptNum
-	c.ShortCourse = dept + deptNum
+	c.CourseFull = code.Full()
+	c.ShortCourse = code.Short()
+	return nil
 }
 
 func (c *Course) setBulletinURL() {
-	courseRegex := re.FindStringSubmatch(strings.Replace(c.Course, " ", "_", 6))
-	dept, deptNum, symbol, section := courseRegex[1], courseRegex[2], courseRegex[3], courseRegex[4]
+	code, err := coursecode.Parse(c.Course)
+	if err != nil {
+		c.BulletinURL = ""
+		return
+	}
+	term, err := ParseTerm(c.Term)
+	if err != nil {
+		c.BulletinURL = ""
+		return
+	}
 
 	// GOAL: http://www.columbia.edu/cu/bulletin/uwb/subj/COMS/W4995-20143-001/
-	c.BulletinURL = fmt.Sprintf("http://www.columbia.edu/cu/bulletin/uwb/subj/%s/%s-%s-%s/",
-		dept,
-		symbol+deptNum,
-		c.Term,
-		section,
+	c.BulletinURL = fmt.Sprintf("%ssubj/%s/%s-%s-%s/",
+		bulletinURL,
+		code.Dept,
+		code.Symbol+code.Number,
+		term.Code(),
+		code.Section,
 	)
 }
 
@@ -139,31 +135,35 @@ func parsePage(page []byte) string {
 }
 
 // scrapes the bulletin to get the description of a course
-func (c *Course) getDescription() error {
-	// locks while requesting
-	httpSemaphore <- 1
-	resp, err := http.Get(c.BulletinURL)
-	defer resp.Body.Close()
-	<-httpSemaphore
+func (c *Course) getDescription(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BulletinURL, nil)
+	if err != nil {
+		c.BulletinURL = ""
+		return fmt.Errorf("Failed to form bulletin request for course, %s, %s", c.Course, err.Error())
+	}
+	resp, err := bulletinClient.Do(req)
 
 	// check for errors
 	if err != nil {
+		slog.Warn("error getting bulletin page", "url", c.BulletinURL, "err", err.Error())
 		c.BulletinURL = ""
-		log.Printf("Error getting bulletin page, %s => %s", c.BulletinURL, err.Error())
 		return fmt.Errorf("HTTP error querying bulletin for course, %s, %s", c.Course, err.Error())
-	} else if resp.StatusCode/100 != 2 {
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		slog.Warn("error getting bulletin page", "url", c.BulletinURL, "status", resp.StatusCode)
 		c.BulletinURL = ""
-		log.Printf("%d error getting bulletin page, %s", resp.StatusCode, c.BulletinURL)
 		return fmt.Errorf("Error querying bulletin for course, %s", c.Course)
 	}
 
 	// read in then sanitize description
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Error reading in page (%s) body => %s", c.BulletinURL, err.Error())
+		slog.Warn("error reading bulletin page", "url", c.BulletinURL, "err", err.Error())
 	}
 
-	// parse the page for the description
+	// parse the page for the full instructor names and the description
+	c.BulletinInstructors = parsePageInstructors(bodyBytes)
 	courseDesc := parsePage(bodyBytes)
 	if courseDesc == "" { // set to 'no description' if there is not one
 		c.Description = "no description"
@@ -173,75 +173,134 @@ func (c *Course) getDescription() error {
 	return nil
 }
 
-// Course holds all information about an instance of a course
+// bulletinPage is what is read from a section's bulletin page
+type bulletinPage struct {
+	Description string
+	Instructors []string
+}
+
+// scrapeDescriptions() reads courses from 'in', fetches their descriptions and
+// full instructor names from the bulletin with up to MaxHTTPRequests requests
+// open at a time, then passes them on to 'out'. Each section has its own page,
+// listing its own instructors, so pages are cached by BulletinURL rather than
+// by course. 'out' is always closed on return.
+func scrapeDescriptions(ctx context.Context, in <-chan Course, out chan<- Course, stats *runStats) error {
+	defer close(out)
+
+	var (
+		mu        sync.Mutex
+		pageCache = make(map[string]bulletinPage) // BulletinURL --> page
+	)
+	g, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < MaxHTTPRequests; i++ {
+		g.Go(func() error {
+			for c := range in {
+				mu.Lock()
+				cached, ok := pageCache[c.BulletinURL]
+				mu.Unlock()
+
+				if ok {
+					c.Description, c.BulletinInstructors = cached.Description, cached.Instructors
+				} else if err := c.getDescription(ctx); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					stats.add(scrapeFailures, 1)
+					slog.Warn("could not get description", "course", c.Course, "err", err.Error())
+				} else {
+					stats.add(scrapedDescriptions, 1)
+					mu.Lock()
+					pageCache[c.BulletinURL] = bulletinPage{c.Description, c.BulletinInstructors}
+					mu.Unlock()
+				}
+
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// Course holds all information about an instance of a course. A field tagged
+// `db` is stored in that column of each group of tables in its `tables` tag,
+// see storeTable, and `type:"int"` marks an integer column.
 type Course struct {
 	Course2
 	Section
-	Course      string `json:",omitempty"`
-	ShortCourse string `json:"-"`
-	ChargeMsg1  string `json:",omitempty"`
-	ChargeAmt1  string `json:",omitempty"`
-	ChargeMsg2  string `json:",omitempty"`
-	ChargeAmt2  string `json:",omitempty"`
+	Course      string `json:",omitempty" db:"course" tables:"legacy"`
+	ShortCourse string `json:"-" db:"course" tables:"courses,sections"`
+	ChargeMsg1  string `json:",omitempty" db:"chargemsg1" tables:"legacy"`
+	ChargeAmt1  string `json:",omitempty" db:"chargeamt1" tables:"legacy"`
+	ChargeMsg2  string `json:",omitempty" db:"chargemsg2" tables:"legacy"`
+	ChargeAmt2  string `json:",omitempty" db:"chargeamt2" tables:"legacy"`
+
+	BulletinInstructors []string `json:"-"` // full instructor names from the bulletin page, if it was scraped
 }
 
 // Course2 holds all information a Course offered (ignoring section details)
 type Course2 struct {
-	CourseFull       string `json:",omitempty"`
-	PrefixName       string `json:",omitempty"`
-	DivisionCode     string `json:",omitempty"`
-	DivisionName     string `json:",omitempty"`
-	SchoolCode       string `json:",omitempty"`
-	SchoolName       string `json:",omitempty"`
-	DepartmentCode   string `json:",omitempty"`
-	DepartmentName   string `json:",omitempty"`
-	SubtermCode      string `json:",omitempty"`
-	SubtermName      string `json:",omitempty"`
-	EnrollmentStatus string `json:",omitempty"`
-	NumFixedUnits    string `json:",omitempty"`
-	MinUnits         string `json:",omitempty"`
-	MaxUnits         string `json:",omitempty"`
-	CourseTitle      string `json:",omitempty"`
-	CourseSubtitle   string `json:",omitempty"`
-	Approval         string `json:",omitempty"`
-	BulletinFlags    string `json:",omitempty"`
-	ClassNotes       string `json:",omitempty"`
-	PrefixLongname   string `json:",omitempty"`
-	Description      string `json:",omitempty"`
+	CourseFull       string `json:",omitempty" db:"coursefull" tables:"courses"`
+	PrefixName       string `json:",omitempty" db:"prefixname" tables:"legacy,courses"`
+	DivisionCode     string `json:",omitempty" db:"divisioncode" tables:"legacy,courses"`
+	DivisionName     string `json:",omitempty" db:"divisionname" tables:"legacy,courses"`
+	SchoolCode       string `json:",omitempty" db:"schoolcode" tables:"legacy,courses"`
+	SchoolName       string `json:",omitempty" db:"schoolname" tables:"legacy,courses"`
+	DepartmentCode   string `json:",omitempty" db:"departmentcode" tables:"legacy,courses"`
+	DepartmentName   string `json:",omitempty" db:"departmentname" tables:"legacy,courses"`
+	SubtermCode      string `json:",omitempty" db:"subtermcode" tables:"legacy,courses"`
+	SubtermName      string `json:",omitempty" db:"subtermname" tables:"legacy,courses"`
+	EnrollmentStatus string `json:",omitempty" db:"enrollmentstatus" tables:"legacy,courses,sections"`
+	NumFixedUnits    string `json:",omitempty" db:"numfixedunits" type:"int" tables:"legacy,courses"`
+	MinUnits         string `json:",omitempty" db:"minunits" type:"int" tables:"legacy,courses"`
+	MaxUnits         string `json:",omitempty" db:"maxunits" type:"int" tables:"legacy,courses"`
+	CourseTitle      string `json:",omitempty" db:"coursetitle" tables:"legacy,courses"`
+	CourseSubtitle   string `json:",omitempty" db:"coursesubtitle" tables:"legacy,courses"`
+	Approval         string `json:",omitempty" db:"approval" tables:"legacy,courses"`
+	BulletinFlags    string `json:",omitempty" db:"bulletinflags" tables:"legacy,courses"`
+	ClassNotes       string `json:",omitempty" db:"classnotes" tables:"legacy,courses"`
+	PrefixLongname   string `json:",omitempty" db:"prefixlongname" tables:"legacy,courses"`
+	Description      string `json:",omitempty" db:"description" tables:"legacy,courses"`
 }
 
 // Section holds all information about a course's individual section
 type Section struct {
 	BulletinURL     string `json:",omitempty"`
 	SectionFull     string `json:",omitempty"`
-	Term            string `json:",omitempty"`
-	MeetsOn1        string `json:",omitempty"`
-	StartTime1      string `json:",omitempty"`
-	EndTime1        string `json:",omitempty"`
-	Building1       string `json:",omitempty"`
-	Room1           string `json:",omitempty"`
-	MeetsOn2        string `json:",omitempty"`
-	StartTime2      string `json:",omitempty"`
-	EndTime2        string `json:",omitempty"`
-	Building2       string `json:",omitempty"`
-	Room2           string `json:",omitempty"`
-	CallNumber      string `json:",omitempty,int"`
-	CampusCode      string `json:",omitempty"`
-	CampusName      string `json:",omitempty"`
-	NumEnrolled     string `json:",omitempty,int"`
-	MaxSize         string `json:",omitempty,int"`
-	TypeCode        string `json:",omitempty"`
-	TypeName        string `json:",omitempty"`
-	Meets1          string `json:",omitempty"`
-	Meets2          string `json:",omitempty"`
-	Meets3          string `json:",omitempty"`
-	Meets4          string `json:",omitempty"`
-	Meets5          string `json:",omitempty"`
-	Meets6          string `json:",omitempty"`
-	Instructor1Name string `json:",omitempty"`
-	Instructor2Name string `json:",omitempty"`
-	Instructor3Name string `json:",omitempty"`
-	Instructor4Name string `json:",omitempty"`
-	ExamMeet        string `json:",omitempty"`
-	ExamDate        string `json:",omitempty"`
+	Term            string `json:",omitempty" db:"term" tables:"legacy,courses,sections"`
+	MeetsOn1        string `json:",omitempty" db:"meetson1" tables:"legacy,sections"`
+	StartTime1      string `json:",omitempty" db:"starttime1" tables:"legacy,sections"`
+	EndTime1        string `json:",omitempty" db:"endtime1" tables:"legacy,sections"`
+	Building1       string `json:",omitempty" db:"building1" tables:"legacy,sections"`
+	Room1           string `json:",omitempty" db:"room1" tables:"legacy,sections"`
+	MeetsOn2        string `json:",omitempty" db:"meetson2" tables:"sections"`
+	StartTime2      string `json:",omitempty" db:"starttime2" tables:"sections"`
+	EndTime2        string `json:",omitempty" db:"endtime2" tables:"sections"`
+	Building2       string `json:",omitempty" db:"building2" tables:"sections"`
+	Room2           string `json:",omitempty" db:"room2" tables:"sections"`
+	CallNumber      string `json:",omitempty" db:"callnumber" type:"int" tables:"legacy,sections"`
+	CampusCode      string `json:",omitempty" db:"campuscode" tables:"legacy,sections"`
+	CampusName      string `json:",omitempty" db:"campusname" tables:"legacy,sections"`
+	NumEnrolled     string `json:",omitempty" db:"numenrolled" type:"int" tables:"legacy,sections"`
+	MaxSize         string `json:",omitempty" db:"maxsize" type:"int" tables:"legacy,sections"`
+	TypeCode        string `json:",omitempty" db:"typecode" tables:"legacy,sections"`
+	TypeName        string `json:",omitempty" db:"typename" tables:"legacy,sections"`
+	Meets1          string `json:",omitempty" db:"meets1" tables:"legacy,sections"`
+	Meets2          string `json:",omitempty" db:"meets2" tables:"legacy,sections"`
+	Meets3          string `json:",omitempty" db:"meets3" tables:"legacy,sections"`
+	Meets4          string `json:",omitempty" db:"meets4" tables:"legacy,sections"`
+	Meets5          string `json:",omitempty" db:"meets5" tables:"legacy,sections"`
+	Meets6          string `json:",omitempty" db:"meets6" tables:"legacy,sections"`
+	Instructor1Name string `json:",omitempty" db:"instructor1name" tables:"legacy,sections"`
+	Instructor2Name string `json:",omitempty" db:"instructor2name" tables:"legacy,sections"`
+	Instructor3Name string `json:",omitempty" db:"instructor3name" tables:"legacy,sections"`
+	Instructor4Name string `json:",omitempty" db:"instructor4name" tables:"legacy,sections"`
+	ExamMeet        string `json:",omitempty" db:"exammeet" tables:"legacy,sections"`
+	ExamDate        string `json:",omitempty" db:"examdate" tables:"legacy,sections"`
+
+	Meetings []Meeting `json:",omitempty"` // parsed from Meets1-6
 }
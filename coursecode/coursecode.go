@@ -0,0 +1,129 @@
+// Package coursecode parses the course codes of Columbia and Barnard sections,
+// EX: "COMS4995W001" is section 001 of COMS W4995.
+package coursecode
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrEmpty is returned for a blank course code
+var ErrEmpty = errors.New("coursecode: empty course code")
+
+// ParseError describes a course code that could not be parsed
+type ParseError struct {
+	Code   string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("coursecode: failed to parse %q, %s", e.Code, e.Reason)
+}
+
+// padding fills out departments shorter than four characters, EX: "ART 1010V001"
+const padding = " _"
+
+var (
+	dept = regexp.MustCompile(`^[A-Z]{2,4}$`)
+
+	// what follows a padded department: [symbol] number symbol section
+	rest = regexp.MustCompile(`^([A-Z]?)(\d{4})([A-Z])([A-Z0-9]{1,3})$`)
+
+	// an unpadded code, the department is as long as it can be
+	unpadded = regexp.MustCompile(`^([A-Z]{2,4})([A-Z]?)(\d{4})([A-Z])([A-Z0-9]{1,3})$`)
+
+	// a course without its section, EX: COMSW4118, ARTV1010 or ART_V1010
+	course = regexp.MustCompile(`^([A-Z]{2,4})[ _]*([A-Z])(\d{4})$`)
+)
+
+// bulletinSymbols are the two letter symbols the bulletin and descriptions
+// write before a course's number in place of its one letter symbol, EX: "ECON
+// BC3035" for a Barnard course
+var bulletinSymbols = map[string]bool{
+	"BC": true, // Barnard College
+	"CC": true, // Columbia College
+	"GS": true, // General Studies
+	"GR": true, // graduate
+	"GU": true, // graduate and undergraduate
+	"UN": true, // undergraduate
+}
+
+// IsSymbol reports whether 's' is written as a course's symbol, either a
+// single letter or one of the bulletin's two letter symbols, EX: "W" or "BC"
+func IsSymbol(s string) bool {
+	return len(s) == 1 && s[0] >= 'A' && s[0] <= 'Z' || bulletinSymbols[s]
+}
+
+// CourseCode is a parsed course code
+type CourseCode struct {
+	Dept    string // EX: COMS, ART
+	Number  string // EX: 4995
+	Symbol  string // EX: W
+	Section string // EX: 001, R01, D1
+}
+
+// Parse reads a course code. Codes are the department, number, symbol and
+// section, EX: "COMS4995W001". Departments of two or three characters may be
+// padded with spaces or underscores, and the symbol may also precede the
+// number, EX: "ACTUK4850K001".
+func Parse(code string) (CourseCode, error) {
+	s := strings.ToUpper(strings.TrimRight(strings.TrimSpace(code), padding))
+	if s == "" {
+		return CourseCode{}, ErrEmpty
+	}
+
+	var parts []string
+	if i := strings.IndexAny(s, padding); i >= 0 {
+		if !dept.MatchString(s[:i]) {
+			return CourseCode{}, &ParseError{Code: code, Reason: "the department must be 2 to 4 letters"}
+		}
+		res := rest.FindStringSubmatch(strings.TrimLeft(s[i:], padding))
+		if res == nil {
+			return CourseCode{}, &ParseError{Code: code, Reason: "expected a 4 digit number, a symbol and a section after the department"}
+		}
+		parts = append([]string{s[:i]}, res[1:]...)
+	} else {
+		res := unpadded.FindStringSubmatch(s)
+		if res == nil {
+			return CourseCode{}, &ParseError{Code: code, Reason: "expected a department, a 4 digit number, a symbol and a section"}
+		}
+		parts = res[1:]
+	}
+
+	prefix, c := parts[1], CourseCode{Dept: parts[0], Number: parts[2], Symbol: parts[3], Section: parts[4]}
+	if prefix != "" && prefix != c.Symbol {
+		return CourseCode{}, &ParseError{Code: code, Reason: fmt.Sprintf("the symbols %s and %s differ", prefix, c.Symbol)}
+	}
+	return c, nil
+}
+
+// ParseCourse reads a course without a section, as Full writes it, EX:
+// "COMSW4118" or "ARTV1010". Departments of two or three characters may also
+// be padded, EX: "ART_V1010". The Section of the code is empty.
+func ParseCourse(s string) (CourseCode, error) {
+	res := course.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if res == nil {
+		if strings.TrimSpace(s) == "" {
+			return CourseCode{}, ErrEmpty
+		}
+		return CourseCode{}, &ParseError{Code: s, Reason: "expected a department, a symbol and a 4 digit number"}
+	}
+	return CourseCode{Dept: res[1], Symbol: res[2], Number: res[3]}, nil
+}
+
+// Full is the course with its symbol, EX: COMSW4995
+func (c CourseCode) Full() string {
+	return c.Dept + c.Symbol + c.Number
+}
+
+// Short is the course without its symbol, EX: COMS4995
+func (c CourseCode) Short() string {
+	return c.Dept + c.Number
+}
+
+// String is the code in the fixed width form it is parsed from, EX: "ART_1010V001"
+func (c CourseCode) String() string {
+	return c.Dept + strings.Repeat("_", 4-len(c.Dept)) + c.Number + c.Symbol + c.Section
+}
@@ -0,0 +1,112 @@
+package coursecode
+
+import (
+	"errors"
+	"testing"
+)
+
+var parseInputs = map[string]CourseCode{ // code --> expected, zero when invalid
+	"COMS4995W001":   {Dept: "COMS", Number: "4995", Symbol: "W", Section: "001"},
+	"coms4995w001":   {Dept: "COMS", Number: "4995", Symbol: "W", Section: "001"},
+	"ACTUK4850K001":  {Dept: "ACTU", Number: "4850", Symbol: "K", Section: "001"},
+	"ART 1010V001":   {Dept: "ART", Number: "1010", Symbol: "V", Section: "001"},
+	"ART_V1010V001":  {Dept: "ART", Number: "1010", Symbol: "V", Section: "001"},
+	"EE  E4000E001":  {Dept: "EE", Number: "4000", Symbol: "E", Section: "001"},
+	"ECON1105BR01":   {Dept: "ECON", Number: "1105", Symbol: "B", Section: "R01"},
+	"SPAN1101BD1":    {Dept: "SPAN", Number: "1101", Symbol: "B", Section: "D1"},
+	"HIST3000W01 ":   {Dept: "HIST", Number: "3000", Symbol: "W", Section: "01"},
+	"ACTUK4850W001":  {}, // symbols differ
+	"COMS499W001":    {},
+	"COMS4995W0001":  {},
+	"C0MS4995W001":   {},
+	"ABCDE_4995W001": {},
+	"bad":            {},
+}
+
+func TestParse(t *testing.T) {
+	for code, expected := range parseInputs {
+		c, err := Parse(code)
+		if expected == (CourseCode{}) {
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Errorf("Expected a ParseError for %q, found %#v, %v", code, c, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse %q => %s", code, err.Error())
+		} else if c != expected {
+			t.Errorf("Expected %q to be %#v, found %#v", code, expected, c)
+		}
+	}
+
+	if _, err := Parse("  "); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, found %v", err)
+	}
+}
+
+var parseCourseInputs = map[string]string{ // course --> Full, empty when invalid
+	"COMSW4118":  "COMSW4118",
+	"comsw4118 ": "COMSW4118",
+	"ARTV1010":   "ARTV1010",
+	"ART_V1010":  "ARTV1010",
+	"ART V1010":  "ARTV1010",
+	"EEE4000":    "EEE4000",
+	"CO4118":     "",
+	"COMSW411":   "",
+	"COMSW4118X": "",
+	"ABCDEW4118": "",
+}
+
+func TestParseCourse(t *testing.T) {
+	for s, expected := range parseCourseInputs {
+		c, err := ParseCourse(s)
+		if expected == "" {
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Errorf("Expected a ParseError for %q, found %#v, %v", s, c, err)
+			}
+		} else if err != nil {
+			t.Errorf("Failed to parse %q => %s", s, err.Error())
+		} else if c.Full() != expected {
+			t.Errorf("Expected %q to be %s, found %s", s, expected, c.Full())
+		}
+	}
+	if _, err := ParseCourse(""); err != ErrEmpty {
+		t.Errorf("Expected ErrEmpty, found %v", err)
+	}
+}
+
+func TestIsSymbol(t *testing.T) {
+	for s, expected := range map[string]bool{"W": true, "BC": true, "UN": true, "EE": false, "w": false, "": false, "COMS": false} {
+		if IsSymbol(s) != expected {
+			t.Errorf("Expected IsSymbol(%q) to be %t", s, expected)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	c := CourseCode{Dept: "ART", Number: "1010", Symbol: "V", Section: "001"}
+	if c.Full() != "ARTV1010" || c.Short() != "ART1010" || c.String() != "ART_1010V001" {
+		t.Errorf("Unexpected formats, %s %s %s", c.Full(), c.Short(), c)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for code := range parseInputs {
+		f.Add(code)
+	}
+	f.Fuzz(func(t *testing.T, code string) {
+		c, err := Parse(code)
+		if err != nil {
+			return
+		}
+		if c.Dept == "" || c.Number == "" || c.Symbol == "" || c.Section == "" {
+			t.Fatalf("Parsed %q into a partial code, %#v", code, c)
+		}
+		again, err := Parse(c.String())
+		if err != nil || again != c {
+			t.Fatalf("Expected %q to parse back to %#v, found %#v, %v", c.String(), c, again, err)
+		}
+	})
+}
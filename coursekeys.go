@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// paddedKey matches the keys written before course codes were parsed by the
+// coursecode package, when departments shorter than four letters were padded
+// with '_', EX: ART_1010 and ART_V1010 rather than ART1010 and ARTV1010
+const paddedKey = `LIKE '%\_%'`
+
+// unpad() is the SQL rewriting a padded key in 'column' to its current form
+func unpad(column string) string {
+	return fmt.Sprintf("replace(%s, '_', '')", column)
+}
+
+// courseKeyMigrations move every row stored under a padded course key to its
+// current key. A row already stored under the current key, by a load since, is
+// kept over the padded one. The course rows are copied first and removed last
+// so the tables referencing them can be moved in between.
+func courseKeyMigrations() []string {
+	names := coursesTable.columnNames()
+	selected := make([]string, len(names))
+	for i, name := range names {
+		selected[i] = name
+		if name == "course" || name == "coursefull" {
+			selected[i] = unpad(name)
+		}
+	}
+
+	return []string{
+		fmt.Sprintf(`INSERT INTO courses_v2_t (%s) SELECT %s FROM courses_v2_t WHERE course %s ON CONFLICT (course) DO NOTHING`,
+			strings.Join(names, ", "), strings.Join(selected, ", "), paddedKey),
+
+		`DELETE FROM course_terms_t O WHERE course ` + paddedKey + ` AND EXISTS (
+		 SELECT 1 FROM course_terms_t N WHERE N.course = ` + unpad("O.course") + ` AND N.term = O.term)`,
+		`UPDATE course_terms_t SET course = ` + unpad("course") + `, coursefull = ` + unpad("coursefull") + ` WHERE course ` + paddedKey,
+
+		`UPDATE sections_v2_t SET course = ` + unpad("course") + ` WHERE course ` + paddedKey,
+		`UPDATE enrollment_snapshots_t SET course = ` + unpad("course") + ` WHERE course ` + paddedKey,
+		`UPDATE change_events_t SET course = ` + unpad("course") + ` WHERE course ` + paddedKey,
+		`UPDATE room_occupancy_t SET course = ` + unpad("course") + ` WHERE course ` + paddedKey,
+		`UPDATE courses_t SET course = ` + unpad("course") + ` WHERE course ` + paddedKey,
+
+		`DELETE FROM courses_add_info O WHERE coursefull ` + paddedKey + ` AND EXISTS (
+		 SELECT 1 FROM courses_add_info N WHERE N.coursefull = ` + unpad("O.coursefull") + `)`,
+		`UPDATE courses_add_info SET coursefull = ` + unpad("coursefull") + ` WHERE coursefull ` + paddedKey,
+
+		// the requisites are extracted again once the courses are moved
+		`DELETE FROM prerequisites_t WHERE course ` + paddedKey,
+		`DELETE FROM cross_listings_t WHERE course ` + paddedKey,
+	}
+}
+
+// migrateCourseKeys() moves the rows stored under padded course keys to their
+// current keys, returning how many courses were moved
+func migrateCourseKeys(ctx context.Context, db *sql.DB) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	for _, query := range courseKeyMigrations() {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return 0, fmt.Errorf("Failed to migrate course keys => %s", err.Error())
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM courses_v2_t WHERE course `+paddedKey)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to remove padded courses => %s", err.Error())
+	}
+	moved, _ := res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Failed to commit course keys => %s", err.Error())
+	}
+
+	if err := updateRequisites(ctx, db); err != nil {
+		return moved, err
+	}
+	return moved, nil
+}
+
+// migrateCourseKeysCmd() moves the rows stored under padded course keys, then
+// rebuilds the ES index from them
+func migrateCourseKeysCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate-course-keys", flag.ExitOnError)
+	skipES := flags.Bool("skip-es", false, "Skip running the ES index updates")
+	flags.Parse(args)
+
+	db := connectPG()
+	defer db.Close()
+
+	moved, err := migrateCourseKeys(ctx, db)
+	if err != nil {
+		return err
+	}
+	log.Printf("Moved %d courses to their current keys", moved)
+
+	if *skipES {
+		return nil
+	}
+	return updateES(ctx, db, nil)
+}
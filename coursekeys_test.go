@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCourseKeyMigrations(t *testing.T) {
+	insert := courseKeyMigrations()[0]
+	for _, expected := range []string{
+		"replace(course, '_', '')",
+		"replace(coursefull, '_', '')",
+		`WHERE course LIKE '%\_%' ON CONFLICT (course) DO NOTHING`,
+	} {
+		if !strings.Contains(insert, expected) {
+			t.Errorf("Expected the course copy to contain %q, found %s", expected, insert)
+		}
+	}
+	for _, table := range []string{"sections_v2_t", "enrollment_snapshots_t", "change_events_t", "room_occupancy_t", "courses_t"} {
+		expected := "UPDATE " + table + " SET course = replace(course, '_', '') WHERE course LIKE '%\\_%'"
+		found := false
+		for _, query := range courseKeyMigrations() {
+			found = found || query == expected
+		}
+		if !found {
+			t.Errorf("Expected the course keys of %s to be moved", table)
+		}
+	}
+	if columns := "INSERT INTO courses_v2_t (" + strings.Join(coursesTable.columnNames(), ", ") + ")"; !strings.HasPrefix(insert, columns) {
+		t.Errorf("Expected the course copy to insert every column, found %s", insert)
+	}
+}
+
+func TestMigrateCourseKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	for _, query := range courseKeyMigrations() {
+		mock.ExpectExec(regexp.QuoteMeta(query)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`DELETE FROM courses_v2_t WHERE course LIKE`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	// the requisites are extracted again under the new keys
+	mock.ExpectQuery(`SELECT course, coalesce\(description, ''\) FROM courses_v2_t`).
+		WillReturnRows(sqlmock.NewRows([]string{"course", "description"}).AddRow("ART1010", "Prerequisites: ART V1001."))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM prerequisites_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM cross_listings_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO prerequisites_t`).
+		WithArgs("ART1010", "ART V1001", `{"Course":"ART1001"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	moved, err := migrateCourseKeys(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Failed to migrate course keys => %s", err.Error())
+	}
+	if moved != 3 {
+		t.Errorf("Expected 3 courses to be moved, found %d", moved)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// the course pipeline is run end to end over test_files/doc.json against a
+// fake bulletin, a fake ES and a mocked Postgres
+const e2eDoc = "./test_files/doc.json"
+
+// fakeBulletin serves the pages under test_files by CourseFull, EX:
+// /subj/ACTU/K4850-20143-001/ => test_files/ACTUK4850.html
+type fakeBulletin struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (b *fakeBulletin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.requests = append(b.requests, r.URL.Path)
+	b.mu.Unlock()
+
+	// EX: ["subj", "ACTU", "K4850-20143-001"]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "subj" {
+		http.NotFound(w, r)
+		return
+	}
+	page, err := ioutil.ReadFile(fmt.Sprintf("./test_files/%s%s.html", parts[1], strings.Split(parts[2], "-")[0]))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(page)
+}
+
+// fakeES records the index changes and bulk requests it is sent
+type fakeES struct {
+	mu      sync.Mutex
+	indexes []string // EX: "PUT /data"
+	bulk    []string // request bodies
+}
+
+func (e *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r.URL.Path == "/_bulk" && r.Method == "POST" {
+		e.bulk = append(e.bulk, string(body))
+	} else {
+		e.indexes = append(e.indexes, r.Method+" "+r.URL.Path)
+	}
+	w.Write([]byte(`{"acknowledged":true}`))
+}
+
+// startFakes() points the bulletin and ES at fakes for the length of the test
+func startFakes(t *testing.T) (*fakeBulletin, *fakeES) {
+	bulletin, es := &fakeBulletin{}, &fakeES{}
+	bulletinSrv, esSrv := httptest.NewServer(bulletin), httptest.NewServer(es)
+
+	oldBulletin, oldES := bulletinURL, esURL
+	bulletinURL, esURL = bulletinSrv.URL+"/", esSrv.URL+"/"
+	t.Cleanup(func() {
+		bulletinURL, esURL = oldBulletin, oldES
+		bulletinSrv.Close()
+		esSrv.Close()
+	})
+	return bulletin, es
+}
+
+// recordArg matches any value, keeping those it sees
+type recordArg struct {
+	mu     sync.Mutex
+	values []string
+}
+
+func (a *recordArg) Match(v driver.Value) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.values = append(a.values, fmt.Sprint(v))
+	return true
+}
+
+// anyArgs() matches the table's columns, with those in 'at' matched by their
+// own matcher
+func anyArgs(t storeTable, at map[string]driver.Value) []driver.Value {
+	var args []driver.Value
+	for _, name := range t.columnNames() {
+		if a, ok := at[name]; ok {
+			args = append(args, a)
+		} else {
+			args = append(args, sqlmock.AnyArg())
+		}
+	}
+	return args
+}
+
+func newE2EMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// the stages query concurrently, so expectations match in any order
+	mock.MatchExpectationsInOrder(false)
+	return db, mock
+}
+
+func TestLoadEndToEnd(t *testing.T) {
+	bulletin, es := startFakes(t)
+	db, mock := newE2EMock(t)
+
+	mock.ExpectQuery(`SELECT checksum FROM load_runs`).WithArgs(true).WillReturnRows(sqlmock.NewRows([]string{"checksum"}))
+	mock.ExpectQuery(`INSERT INTO load_runs`).
+		WithArgs(testStarted, e2eDoc, sqlmock.AnyArg(), esIndex, runRunning).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	// each section is new, and is written with its meetings and instructors
+	descriptions := &recordArg{}
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`FROM sections_v2_t\s+WHERE term = \$1 AND callnumber = \$2`).
+			WillReturnRows(sqlmock.NewRows([]string{"numenrolled"}))
+		mock.ExpectExec(`INSERT INTO courses_t`).
+			WithArgs(anyArgs(legacyCoursesTable, map[string]driver.Value{"description": descriptions})...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO courses_v2_t`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO course_terms_t`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO sections_v2_t`).WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM section_instructors_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM section_meetings_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+	}
+	for id := 1; id <= 2; id++ { // John N Vitucci and Lisa Minetti
+		mock.ExpectQuery(`SELECT id, canonical\s+FROM instructors_t\s+WHERE left\(lastname, 3\) = left\(\$1, 3\)`).WillReturnRows(sqlmock.NewRows([]string{"id", "canonical"}))
+		mock.ExpectQuery(`INSERT INTO instructors_t`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	}
+	for i := 0; i < 3; i++ { // Vitucci teaches both sections
+		mock.ExpectExec(`INSERT INTO section_instructors_t`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO section_meetings_t`).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// prerequisites are extracted from the stored descriptions
+	mock.ExpectQuery(`SELECT course, coalesce\(description, ''\) FROM courses_v2_t`).
+		WillReturnRows(sqlmock.NewRows([]string{"course", "description"}).
+			AddRow("ACTU4620", "no description").
+			AddRow("ACTU4850", "A workshop. Prerequisites: ACTU K4620 or the instructor's permission. Cross-listed with BUSI K4850."))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM prerequisites_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM cross_listings_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO prerequisites_t`).
+		WithArgs("ACTU4850", "ACTU K4620 or the instructor's permission", `{"Any":[{"Course":"ACTU4620"},{"Permission":true}]}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO cross_listings_t`).WithArgs("ACTU4850", "BUSI4850").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// both sections are still active, so none are cancelled
+	mock.ExpectQuery(`FROM sections_v2_t\s+WHERE term = \$1 AND cancelled_at IS NULL`).
+		WithArgs("20143").
+		WillReturnRows(sqlmock.NewRows([]string{"callnumber", "course"}).AddRow("13704", "ACTU4850").AddRow("13705", "ACTU4620"))
+
+	esColumns := []string{"course", "coursefull", "departmentcode", "departmentname", "coursetitle", "coursesubtitle",
+		"description", "term", "callnumber", "instructor", "globalcore", "corecurriculum", "writingintensive", "labscience",
+		"prerequisites", "crosslistings"}
+	mock.ExpectQuery(`FROM courses_v2_t C JOIN sections_v2_t S`).WillReturnRows(sqlmock.NewRows(esColumns).
+		AddRow("ACTU4850", "ACTUK4850", "ACTU", "ACTUARIAL SCIENCE", "ORAL COMM FOR ACTUARIAL PROF", "",
+			"a description", "{20143}", "{13704}", "{John N Vitucci,Lisa Minetti}", false, false, false, false,
+			`{"Any":[{"Course":"ACTU4620"},{"Permission":true}]}`, "{BUSI4850}").
+		AddRow("ACTU4620", "ACTUK4620", "ACTU", "ACTUARIAL SCIENCE", "PENSIONS & ERISA", "",
+			"no description", "{20143}", "{13705}", "{John N Vitucci}", false, false, false, false, nil, "{}"))
+
+	for _, table := range runCountTables {
+		mock.ExpectQuery(`SELECT count\(\*\) FROM ` + table + ` WHERE`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	}
+	mock.ExpectQuery(`SELECT count\(\*\) FROM change_events_t`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE load_runs SET`).
+		WithArgs(7, sqlmock.AnyArg(), "{20143}", sqlmock.AnyArg(), runSucceeded, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stats := newRunStats(testStarted)
+	err := run(context.Background(), db, e2eDoc, false, false, false, loadOptions{
+		StartedAt:  testStarted,
+		MaxRemoved: 0.1,
+		Stats:      stats,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run the load => %s", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if len(bulletin.requests) != 2 {
+		t.Errorf("Expected a bulletin request per section, found %v", bulletin.requests)
+	}
+	found := strings.Join(descriptions.values, "|")
+	if !strings.Contains(found, "This course is a workshop in communication techniques.") {
+		t.Errorf("Expected the scraped description of ACTUK4850 to be stored, found %q", found)
+	}
+	if !strings.Contains(found, "no description") {
+		t.Errorf("Expected ACTUK4620 to be stored without a description, found %q", found)
+	}
+
+	expectedCounts := map[counter]int64{parsedRecords: 2, insertedSections: 2, scrapedDescriptions: 2, esIndexed: 2}
+	for c, n := range expectedCounts {
+		if stats.get(c) != n {
+			t.Errorf("Expected %d %s, found %d", n, counterNames[c], stats.get(c))
+		}
+	}
+
+	if strings.Join(es.indexes, ",") != "DELETE /"+esIndex+",PUT /"+esIndex {
+		t.Errorf("Expected the index to be recreated, found %v", es.indexes)
+	}
+	if len(es.bulk) != 1 {
+		t.Fatalf("Expected a single bulk request, found %d", len(es.bulk))
+	}
+	for _, s := range []string{`"_id":"ACTU4850"`, `"_id":"ACTU4620"`, `"Instructor":["John N Vitucci","Lisa Minetti"]`,
+		`"PrerequisiteCourses":["ACTU4620"]`, `"CrossListings":["BUSI4850"]`} {
+		if !strings.Contains(es.bulk[0], s) {
+			t.Errorf("Expected %s in the bulk request, found %s", s, es.bulk[0])
+		}
+	}
+}
+
+func TestLoadSkipsUnchangedFile(t *testing.T) {
+	bulletin, es := startFakes(t)
+	db, mock := newE2EMock(t)
+
+	checksum, err := fileChecksum(e2eDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(`SELECT checksum FROM load_runs`).WithArgs(true).WillReturnRows(sqlmock.NewRows([]string{"checksum"}).AddRow(checksum))
+	mock.ExpectQuery(`INSERT INTO load_runs`).
+		WithArgs(testStarted, e2eDoc, checksum, nil, runSkipped).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	mock.ExpectExec(`UPDATE load_runs SET`).
+		WithArgs(8, sqlmock.AnyArg(), "{}", "null", runSkipped, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = run(context.Background(), db, e2eDoc, false, false, false, loadOptions{StartedAt: testStarted})
+	if err != nil {
+		t.Fatalf("Failed to run the load => %s", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(bulletin.requests) != 0 || len(es.indexes) != 0 || len(es.bulk) != 0 {
+		t.Errorf("Expected an unchanged file to skip the load, found bulletin %v and ES %v %v", bulletin.requests, es.indexes, es.bulk)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// InsertEnrollmentSnapshot appends the section's current enrollment to the
+// 'enrollment_snapshots_t' time series. Every row written in a run shares the
+// run's 'observedAt' so snapshots can be grouped back into loads.
+func (c Course) InsertEnrollmentSnapshot(ctx context.Context, db *sql.DB, observedAt time.Time) error {
+	query := `INSERT INTO enrollment_snapshots_t (
+	term,
+	callnumber,
+	course,
+	numenrolled,
+	maxsize,
+	enrollmentstatus,
+	observed_at
+	) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7
+	)`
+	_, err := db.ExecContext(
+		ctx,
+		query,
+		c.Term,
+		c.CallNumber,
+		c.ShortCourse,
+		c.NumEnrolled,
+		c.MaxSize,
+		c.EnrollmentStatus,
+		observedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to insert enrollment_snapshots_t, %s %s, => %s", c.Term, c.CallNumber, err.Error())
+	}
+	return nil
+}
+
+// groups the snapshots of a term by 'name' and compares the first and last
+// observation of each group
+var enrollmentTrendQuery = `
+WITH observations AS (
+	SELECT
+		%s AS name,
+		E.observed_at,
+		sum(E.numenrolled) AS enrolled,
+		sum(E.maxsize) AS capacity,
+		count(*) FILTER (WHERE E.enrollmentstatus = $3) AS sections_waitlisted
+	FROM enrollment_snapshots_t E JOIN courses_v2_t C
+	ON C.course = E.course
+	WHERE E.term = $1 AND ($2 = '' OR C.departmentcode = $2)
+	GROUP BY 1, E.observed_at
+)
+SELECT
+	name,
+	F.observed_at,
+	L.observed_at,
+	F.enrolled,
+	L.enrolled,
+	L.capacity,
+	F.sections_waitlisted,
+	L.sections_waitlisted
+ FROM (SELECT DISTINCT ON (name) * FROM observations ORDER BY name, observed_at) F
+ JOIN (SELECT DISTINCT ON (name) * FROM observations ORDER BY name, observed_at DESC) L
+ USING (name)
+ ORDER BY name;
+`
+
+// enrollmentTrend summarizes how a course or department filled up over a term
+type enrollmentTrend struct {
+	Name                    string
+	FirstObserved           time.Time
+	LastObserved            time.Time
+	FirstEnrolled           int
+	LastEnrolled            int
+	Capacity                int
+	FirstSectionsWaitlisted int // # of sections taking a waitlist, not of students on one
+	LastSectionsWaitlisted  int
+}
+
+// FillPercent is the share of seats taken at the last observation
+func (t enrollmentTrend) FillPercent() float64 {
+	if t.Capacity == 0 {
+		return 0
+	}
+	return 100 * float64(t.LastEnrolled) / float64(t.Capacity)
+}
+
+// FillRate is the average # of seats taken per day between the first and last observation
+func (t enrollmentTrend) FillRate() float64 {
+	days := t.LastObserved.Sub(t.FirstObserved).Hours() / 24
+	if days <= 0 {
+		return 0
+	}
+	return float64(t.LastEnrolled-t.FirstEnrolled) / days
+}
+
+// SectionsWaitlistedChange is the change in sections taking a waitlist
+// between the first and last observation
+func (t enrollmentTrend) SectionsWaitlistedChange() int {
+	return t.LastSectionsWaitlisted - t.FirstSectionsWaitlisted
+}
+
+func queryEnrollmentTrends(ctx context.Context, db *sql.DB, term, dept string, byDept bool) ([]enrollmentTrend, error) {
+	group := "E.course"
+	if byDept {
+		group = "C.departmentcode"
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(enrollmentTrendQuery, group), term, dept, waitlistedStatus)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying enrollment snapshots => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var trends []enrollmentTrend
+	for rows.Next() {
+		var t enrollmentTrend
+		err := rows.Scan(
+			&t.Name,
+			&t.FirstObserved,
+			&t.LastObserved,
+			&t.FirstEnrolled,
+			&t.LastEnrolled,
+			&t.Capacity,
+			&t.FirstSectionsWaitlisted,
+			&t.LastSectionsWaitlisted,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Error while processing enrollment snapshots => %s", err.Error())
+		}
+		trends = append(trends, t)
+	}
+	return trends, rows.Err()
+}
+
+// enrollmentCmd() prints fill rates and the sections waitlisted for a term
+func enrollmentCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("enrollment", flag.ExitOnError)
+	term := flags.String("term", "", "Term to report on, EX: 20143")
+	dept := flags.String("dept", "", "Only report on courses in this department code")
+	byDept := flags.Bool("by-dept", false, "Group by department rather than by course")
+	asJSON := flags.Bool("json", false, "Print the trends as JSON")
+	flags.Parse(args)
+	if *term == "" {
+		return fmt.Errorf("-term must be set")
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	trends, err := queryEnrollmentTrends(ctx, db, *term, *dept, *byDept)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(trends)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tENROLLED\tCAPACITY\tFILLED\tSEATS/DAY\tSECTIONS WAITLISTED\tSECTIONS WAITLISTED CHANGE")
+	for _, t := range trends {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%.2f\t%d\t%+d\n",
+			t.Name,
+			t.LastEnrolled,
+			t.Capacity,
+			t.FillPercent(),
+			t.FillRate(),
+			t.LastSectionsWaitlisted,
+			t.SectionsWaitlistedChange(),
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEnrollmentTrend(t *testing.T) {
+	start := time.Date(2014, time.April, 1, 0, 0, 0, 0, time.UTC)
+	trend := enrollmentTrend{
+		FirstObserved:           start,
+		LastObserved:            start.Add(4 * 24 * time.Hour),
+		FirstEnrolled:           20,
+		LastEnrolled:            60,
+		Capacity:                80,
+		FirstSectionsWaitlisted: 0,
+		LastSectionsWaitlisted:  2,
+	}
+
+	if p := trend.FillPercent(); p != 75 {
+		t.Errorf("Expected the course to be 75%% full, found %f", p)
+	}
+	if r := trend.FillRate(); r != 10 {
+		t.Errorf("Expected 10 seats filled per day, found %f", r)
+	}
+	if c := trend.SectionsWaitlistedChange(); c != 2 {
+		t.Errorf("Expected 2 more waitlisted sections, found %d", c)
+	}
+
+	// a single observation has no rate
+	trend.LastObserved = start
+	if r := trend.FillRate(); r != 0 {
+		t.Errorf("Expected no fill rate from one observation, found %f", r)
+	}
+}
+
+func TestQueryEnrollmentTrends(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// sections are counted by the named waitlist status, not a literal
+	start := time.Date(2014, time.April, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`count\(\*\) FILTER \(WHERE E.enrollmentstatus = \$3\) AS sections_waitlisted`).
+		WithArgs("20143", "COMS", waitlistedStatus).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "first", "last", "first_enrolled", "last_enrolled", "capacity", "first_waitlisted", "last_waitlisted"}).
+			AddRow("COMS4118", start, start.Add(24*time.Hour), 10, 20, 40, 0, 1))
+
+	trends, err := queryEnrollmentTrends(context.Background(), db, "20143", "COMS", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trends) != 1 || trends[0].LastSectionsWaitlisted != 1 || trends[0].SectionsWaitlistedChange() != 1 {
+		t.Errorf("Expected one course with a section newly waitlisted, found %#v", trends)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/natebrennand/dataupdates/requisites"
 	"github.com/natebrennand/pg_array"
 )
 
@@ -17,6 +20,7 @@ var (
 	esIndex   string
 	esType    = "courses"
 	batchSize = 200
+	esClient  = &http.Client{Timeout: time.Minute}
 )
 
 func init() {
@@ -39,6 +43,17 @@ type esData struct {
 	Term            pgarray.SqlIntArray
 	CallNumber      pgarray.SqlIntArray
 	Instructor      pgarray.SqlStringArray
+
+	// curated attributes from courses_add_info
+	GlobalCore       bool
+	CoreCurriculum   bool
+	WritingIntensive bool
+	LabScience       bool
+
+	// extracted from the description, see prerequisites_t and cross_listings_t
+	Prerequisites       *requisites.Requirement `json:",omitempty"`
+	PrerequisiteCourses []string                `json:",omitempty"` // every course named in Prerequisites
+	CrossListings       []string                `json:",omitempty"`
 }
 
 type esMetadata struct {
@@ -53,7 +68,7 @@ type esAction struct {
 
 type bulkItem struct {
 	Index esAction
-	Data  esData
+	Data  interface{} // the document, EX: esData
 }
 
 type bulkInsert []bulkItem
@@ -74,19 +89,37 @@ func (b bulkInsert) MarshalJSON() ([]byte, error) {
 }
 
 func (d esData) NewBulkItem() bulkItem {
+	return newBulkItem(d.Course, d)
+}
+
+// newBulkItem() indexes 'doc' in the course index under 'id'
+func newBulkItem(id string, doc interface{}) bulkItem {
 	return bulkItem{
 		Index: esAction{
 			Index: esMetadata{
 				Index: esIndex,
 				Type:  esType,
-				ID:    d.Course,
+				ID:    id,
 			},
 		},
-		Data: d,
+		Data: doc,
+	}
+}
+
+// esQuery selects a document per course from the sections that are not
+// cancelled
+var esQuery = esDataQuery("")
+
+// esDataQuery() is esQuery limited to the courses matching 'filter', a
+// condition on C, the row of courses_v2_t, EX: "C.course IN (...)"
+func esDataQuery(filter string) string {
+	if filter != "" {
+		filter = "AND " + filter
 	}
+	return fmt.Sprintf(esDataFormat, filter)
 }
 
-var esQuery = `
+var esDataFormat = `
 SELECT
 	C.course,
 	C.coursefull,
@@ -97,9 +130,22 @@ SELECT
 	C.description,
 	array_agg(DISTINCT S.term) as "term",
 	array_agg(DISTINCT S.callnumber) as "callnumber",
-	array_agg(DISTINCT S.instructor1name) as "instructor"
+	array_remove(array_agg(DISTINCT I.name), NULL) as "instructor",
+	coalesce(bool_or(A.globalcore), false) as "globalcore",
+	coalesce(bool_or(A.corecurriculum), false) as "corecurriculum",
+	coalesce(bool_or(A.writingintensive), false) as "writingintensive",
+	coalesce(bool_or(A.labscience), false) as "labscience",
+	(SELECT P.expression FROM prerequisites_t P WHERE P.course = C.course) as "prerequisites",
+	array(SELECT X.crosslisted FROM cross_listings_t X WHERE X.course = C.course ORDER BY X.crosslisted) as "crosslistings"
  FROM courses_v2_t C JOIN sections_v2_t S
  ON C.course = S.course
+ LEFT JOIN courses_add_info A
+ ON A.coursefull = C.coursefull
+ LEFT JOIN section_instructors_t SI
+ ON SI.term = S.term AND SI.callnumber = S.callnumber
+ LEFT JOIN instructors_t I
+ ON I.id = SI.instructor_id
+ WHERE S.cancelled_at IS NULL %s
  GROUP BY
 	C.course,
 	C.coursefull,
@@ -107,110 +153,157 @@ SELECT
 	C.departmentname,
 	C.coursetitle,
 	C.coursesubtitle,
-	C.description;
+	C.description
 `
 
-func updateES(db *sql.DB) []esData {
+// scanEsData() reads a row selected by esQuery
+func scanEsData(rows *sql.Rows) (esData, error) {
+	var data esData
+	var prerequisites []byte
+	var crossListings pgarray.SqlStringArray
+	err := rows.Scan(
+		&data.Course,
+		&data.CourseFull,
+		&data.DespartmentCode,
+		&data.DespartmentName,
+		&data.CourseTitle,
+		&data.CourseSubtitle,
+		&data.Description,
+		&data.Term,
+		&data.CallNumber,
+		&data.Instructor,
+		&data.GlobalCore,
+		&data.CoreCurriculum,
+		&data.WritingIntensive,
+		&data.LabScience,
+		&prerequisites,
+		&crossListings,
+	)
+	if err != nil {
+		return data, err
+	}
+
+	if len(prerequisites) > 0 {
+		data.Prerequisites = &requisites.Requirement{}
+		if err := json.Unmarshal(prerequisites, data.Prerequisites); err != nil {
+			return data, fmt.Errorf("Failed to decode prerequisites of %s => %s", data.Course, err.Error())
+		}
+		data.PrerequisiteCourses = data.Prerequisites.Courses()
+	}
+	data.CrossListings = crossListings.Data
+	return data, nil
+}
+
+// updateES() rebuilds the course index from the database. A failed batch is
+// counted in 'stats' and skipped, except for the last.
+func updateES(ctx context.Context, db *sql.DB, stats *runStats) error {
 	// remove the existing ES index
-	if err := deleteIndex(); err != nil {
-		log.Printf("WARNING: %s", err.Error())
+	if err := deleteIndex(ctx, esIndex); err != nil {
+		slog.Warn("failed to delete ES index", "index", esIndex, "err", err.Error())
 	}
-	if err := createIndex(); err != nil {
-		log.Fatalf("WARNING: %s", err.Error())
+	if err := createIndex(ctx, esIndex); err != nil {
+		return err
 	}
 
 	// query for the new data used in the index
-	var esDataList []esData
-	rows, err := db.Query(esQuery)
+	rows, err := db.QueryContext(ctx, esQuery)
 	if err != nil {
-		log.Fatalf("Error while querying Postgres for ES data => %s", err.Error())
+		return fmt.Errorf("Error while querying Postgres for ES data => %s", err.Error())
 	}
 	defer rows.Close()
 
 	// process each record to be inserted to ES
 	var batchBuffer = make([]bulkItem, batchSize)
 	var bufferIndex = 0
-	var data esData
 	for rows.Next() {
-		err := rows.Scan(
-			&data.Course,
-			&data.CourseFull,
-			&data.DespartmentCode,
-			&data.DespartmentName,
-			&data.CourseTitle,
-			&data.CourseSubtitle,
-			&data.Description,
-			&data.Term,
-			&data.CallNumber,
-			&data.Instructor,
-		)
+		data, err := scanEsData(rows)
 		if err != nil {
-			log.Fatalf("Error while processing PG data => %s", err.Error())
+			return fmt.Errorf("Error while processing PG data => %s", err.Error())
 		}
 
 		// add to buffer
 		batchBuffer[bufferIndex] = data.NewBulkItem()
 		bufferIndex++
 		if bufferIndex == batchSize {
-			log.Printf("Inserting batch of %d\n", batchSize)
-			err := insertEsData(bulkInsert(batchBuffer))
+			slog.Info("inserting ES batch", "items", batchSize)
+			err := insertEsData(ctx, bulkInsert(batchBuffer))
 			bufferIndex = 0
 			if err != nil {
-				log.Printf("WARNING: failed to run batch insert => %s\n", err.Error())
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				stats.add(esFailed, int64(batchSize))
+				slog.Warn("failed to run ES batch insert", "items", batchSize, "err", err.Error())
+			} else {
+				stats.add(esIndexed, int64(batchSize))
 			}
 		}
 	}
-	// insert remainder of buffer
-	insertEsData(bulkInsert(batchBuffer[0:bufferIndex]))
-	log.Printf("Inserting batch of %d\n", bufferIndex)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Error while reading PG data => %s", err.Error())
+	}
 
-	return esDataList
+	// insert remainder of buffer
+	slog.Info("inserting ES batch", "items", bufferIndex)
+	if err := insertEsData(ctx, bulkInsert(batchBuffer[0:bufferIndex])); err != nil {
+		stats.add(esFailed, int64(bufferIndex))
+		return err
+	}
+	stats.add(esIndexed, int64(bufferIndex))
+	return nil
 }
 
-func deleteIndex() error {
-	log.Println("Attempting to delete ES index")
-	req, err := http.NewRequest("DELETE", esURL+esIndex, nil)
+func deleteIndex(ctx context.Context, index string) error {
+	slog.Info("deleting ES index", "index", index)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", esURL+index, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to create DELETE request => %s", err.Error())
+	}
 
-	client := http.Client{}
-	resp, err := client.Do(req)
+	resp, err := esClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("Problem deleting ES index => %s", err.Error())
-	} else if resp.StatusCode/100 != 2 {
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf("Failed to read in response body => %s\n", err.Error())
+			slog.Warn("failed to read ES response body", "err", err.Error())
 		}
-		log.Println(string(bodyBytes))
+		slog.Warn("ES error response", "status", resp.StatusCode, "body", string(bodyBytes))
 		return fmt.Errorf("Problem deleting ES index => status code = %d", resp.StatusCode)
 	}
-	log.Println("ES index deleted")
+	slog.Info("ES index deleted", "index", index)
 	return nil
 }
 
-func createIndex() error {
-	log.Println("Attempting to create new ES Index")
+func createIndex(ctx context.Context, index string) error {
+	slog.Info("creating ES index", "index", index)
 
-	req, err := http.NewRequest("PUT", esURL+esIndex, nil)
+	req, err := http.NewRequestWithContext(ctx, "PUT", esURL+index, nil)
 	if err != nil {
 		return fmt.Errorf("Failed to create PUT request => %s", err.Error())
 	}
 
-	client := http.Client{}
-	if resp, err := client.Do(req); err != nil {
-		defer resp.Body.Close()
+	resp, err := esClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to create new ES Index => %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf("Failed to read in response body => %s\n", err.Error())
+			slog.Warn("failed to read ES response body", "err", err.Error())
 		}
-		log.Println(string(bodyBytes))
-		return fmt.Errorf("Failed to create new ES Index => %s", err.Error())
+		slog.Warn("ES error response", "status", resp.StatusCode, "body", string(bodyBytes))
+		return fmt.Errorf("Failed to create new ES Index => status code = %d", resp.StatusCode)
 	}
 
-	log.Printf("ES Index, %s, created", esIndex)
+	slog.Info("ES index created", "index", index)
 	return nil
 }
 
-func insertEsData(data bulkInsert) error {
+func insertEsData(ctx context.Context, data bulkInsert) error {
 	if len(data) == 0 { // don't insert if no data
 		return nil
 	}
@@ -221,21 +314,21 @@ func insertEsData(data bulkInsert) error {
 	}
 	buf := bytes.NewBuffer(jsonBytes)
 
-	client := http.Client{}
-	req, err := http.NewRequest("POST", esURL+"_bulk", buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", esURL+"_bulk", buf)
 	if err != nil {
 		return fmt.Errorf("Failed to form HTTP request.")
 	}
-	resp, err := client.Do(req)
+	resp, err := esClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("Failure stuffing data into ES => %s", err.Error())
-	} else if resp.StatusCode/100 != 2 {
-		defer resp.Body.Close()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf("Failed to read in response body => %s\n", err.Error())
+			slog.Warn("failed to read ES response body", "err", err.Error())
 		}
-		log.Println(string(bodyBytes))
+		slog.Warn("ES error response", "status", resp.StatusCode, "body", string(bodyBytes))
 		return fmt.Errorf("Problem stuffing data into  ES => status code = %d", resp.StatusCode)
 	}
 
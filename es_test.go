@@ -23,6 +23,7 @@ var (
 		Instructor: pgarray.SqlStringArray{
 			Data: []string{"teacher1", "teacher2"},
 		},
+		GlobalCore: true,
 	}
 	testEsAction = esAction{
 		Index: esMetadata{
@@ -67,11 +68,11 @@ func TestBulkInsertMarshal2(t *testing.T) {
 //
 // Spec: http://www.elasticsearch.org/guide/en/elasticsearch/reference/current/docs-bulk.html
 var expectedJSON = `{"index":{"_index":"test","_type":"courses","_id":"123"}}
-{"Course":"test","CourseFull":"123","DespartmentCode":"","DespartmentName":"","CourseTitle":"test","CourseSubtitle":"test course subtitle","Description":"a course for testing","Term":[1,2,3],"CallNumber":[4,5,6],"Instructor":["teacher1","teacher2"]}
+{"Course":"test","CourseFull":"123","DespartmentCode":"","DespartmentName":"","CourseTitle":"test","CourseSubtitle":"test course subtitle","Description":"a course for testing","Term":[1,2,3],"CallNumber":[4,5,6],"Instructor":["teacher1","teacher2"],"GlobalCore":true,"CoreCurriculum":false,"WritingIntensive":false,"LabScience":false}
 `
 
 var expectedJSON2 = `{"index":{"_index":"test","_type":"courses","_id":"123"}}
-{"Course":"test","CourseFull":"123","DespartmentCode":"","DespartmentName":"","CourseTitle":"test","CourseSubtitle":"test course subtitle","Description":"a course for testing","Term":[1,2,3],"CallNumber":[4,5,6],"Instructor":["teacher1","teacher2"]}
+{"Course":"test","CourseFull":"123","DespartmentCode":"","DespartmentName":"","CourseTitle":"test","CourseSubtitle":"test course subtitle","Description":"a course for testing","Term":[1,2,3],"CallNumber":[4,5,6],"Instructor":["teacher1","teacher2"],"GlobalCore":true,"CoreCurriculum":false,"WritingIntensive":false,"LabScience":false}
 {"index":{"_index":"test","_type":"courses","_id":"123"}}
-{"Course":"test","CourseFull":"123","DespartmentCode":"","DespartmentName":"","CourseTitle":"test","CourseSubtitle":"test course subtitle","Description":"a course for testing","Term":[1,2,3],"CallNumber":[4,5,6],"Instructor":["teacher1","teacher2"]}
+{"Course":"test","CourseFull":"123","DespartmentCode":"","DespartmentName":"","CourseTitle":"test","CourseSubtitle":"test course subtitle","Description":"a course for testing","Term":[1,2,3],"CallNumber":[4,5,6],"Instructor":["teacher1","teacher2"],"GlobalCore":true,"CoreCurriculum":false,"WritingIntensive":false,"LabScience":false}
 `
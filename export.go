@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exportSchemaVersion is bumped whenever a column is removed, renamed or
+// changes type, so consumers can tell the files apart. Adding a column does
+// not change it.
+const exportSchemaVersion = 1
+
+// exportFormats are the file formats a table can be exported as
+var exportFormats = []string{"ndjson", "parquet"}
+
+// exportColumn is a column of an exported table
+type exportColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "string" or "int64"
+}
+
+func (c exportColumn) parquetType() int32 {
+	if c.Type == "int64" {
+		return parquetInt64
+	}
+	return parquetByteArray
+}
+
+// exportedTable is a table exported for a term. Its rows are read from Source,
+// limited by Filter with the term as $1 and the departments, or NULL for all
+// of them, as $2. Rows describes which rows are exported, for schema.json.
+type exportedTable struct {
+	Name    string // EX: sections, the name of its files
+	Source  string
+	Columns []exportColumn
+	Filter  string
+	Order   string
+	Rows    string
+}
+
+// the courses of the term in the departments
+const exportDeptCourses = `SELECT course FROM course_terms_t WHERE term = $1 AND departmentcode = ANY($2::text[])`
+
+// exportedTables are the tables that can be exported. The course and section
+// columns are those the loader stores, read from the Course tags.
+var exportedTables = []exportedTable{
+	{
+		Name:    "courses",
+		Source:  courseTermsTable.Name,
+		Columns: storeExportColumns(courseTermsTable),
+		Filter:  `term = $1 AND ($2::text[] IS NULL OR departmentcode = ANY($2::text[]))`,
+		Order:   "course",
+		Rows:    "every course offered in the term",
+	},
+	{
+		Name:    "sections",
+		Source:  sectionsTable.Name,
+		Columns: storeExportColumns(sectionsTable),
+		Filter:  `term = $1 AND cancelled_at IS NULL AND ($2::text[] IS NULL OR course IN (` + exportDeptCourses + `))`,
+		Order:   "callnumber",
+		Rows:    "the sections of the term that are not cancelled",
+	},
+	{
+		Name:   "meetings",
+		Source: "section_meetings_t",
+		Columns: []exportColumn{
+			{Name: "term", Type: "string"},
+			{Name: "callnumber", Type: "int64"},
+			{Name: "slot", Type: "int64"},
+			{Name: "weekday", Type: "string"},
+			{Name: "starttime", Type: "string"},
+			{Name: "endtime", Type: "string"},
+			{Name: "building", Type: "string"},
+			{Name: "room", Type: "string"},
+		},
+		Filter: `term = $1 AND callnumber IN (
+		 SELECT callnumber FROM sections_v2_t
+		 WHERE term = $1 AND cancelled_at IS NULL AND ($2::text[] IS NULL OR course IN (` + exportDeptCourses + `)))`,
+		Order: "callnumber, slot, weekday",
+		Rows:  "the meetings of the sections that are exported",
+	},
+}
+
+// storeExportColumns() lists the table's columns, typed by their Course field
+func storeExportColumns(t storeTable) []exportColumn {
+	var columns []exportColumn
+	for _, col := range t.columns() {
+		typ := "string"
+		if col.Int {
+			typ = "int64"
+		}
+		columns = append(columns, exportColumn{Name: col.Name, Type: typ})
+	}
+	return columns
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerList() splits a comma separated flag of names, EX: "course,term"
+func lowerList(s string) []string {
+	list := splitList(s)
+	for i := range list {
+		list[i] = strings.ToLower(list[i])
+	}
+	return list
+}
+
+// selectExportTables() limits the tables to those named, or all of them if
+// none are, and their columns to those selected, or all of them if none are.
+// A table with none of the selected columns is left out.
+func selectExportTables(names, columns []string) ([]exportedTable, error) {
+	for _, name := range names {
+		found := false
+		for _, t := range exportedTables {
+			found = found || t.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown export table, %s", name)
+		}
+	}
+
+	var tables []exportedTable
+	used := make(map[string]bool)
+	for _, t := range exportedTables {
+		if len(names) > 0 && !hasString(names, t.Name) {
+			continue
+		}
+		if len(columns) > 0 {
+			var selected []exportColumn
+			for _, c := range t.Columns {
+				if hasString(columns, c.Name) {
+					selected = append(selected, c)
+					used[c.Name] = true
+				}
+			}
+			if len(selected) == 0 {
+				continue
+			}
+			t.Columns = selected
+		}
+		tables = append(tables, t)
+	}
+
+	for _, c := range columns {
+		if !used[c] {
+			return nil, fmt.Errorf("unknown export column, %s", c)
+		}
+	}
+	return tables, nil
+}
+
+func (t exportedTable) query() string {
+	names := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		names[i] = c.Name + "::text" // times and integers are read as text
+	}
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s", strings.Join(names, ", "), t.Source, t.Filter, t.Order)
+}
+
+// rows() reads the table's rows for the term and departments, each a value
+// per column, nil for a NULL
+func (t exportedTable) rows(ctx context.Context, db *sql.DB, term string, depts []string) ([][]interface{}, error) {
+	var deptArg interface{}
+	if len(depts) > 0 {
+		deptArg = pgTextArray(depts)
+	}
+	rows, err := db.QueryContext(ctx, t.query(), term, deptArg)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying %s of %s => %s", t.Name, term, err.Error())
+	}
+	defer rows.Close()
+
+	var records [][]interface{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(t.Columns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("Error while processing %s of %s => %s", t.Name, term, err.Error())
+		}
+
+		record := make([]interface{}, len(values))
+		for i, v := range values {
+			if !v.Valid {
+				continue
+			}
+			record[i] = v.String
+			if t.Columns[i].Type == "int64" {
+				n, err := strconv.ParseInt(v.String, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to read %s.%s, %q, as an integer => %s", t.Name, t.Columns[i].Name, v.String, err.Error())
+				}
+				record[i] = n
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// writeNDJSON() writes each row as a JSON object with its keys in column order
+func writeNDJSON(out io.Writer, columns []exportColumn, rows [][]interface{}) error {
+	var line bytes.Buffer
+	for _, row := range rows {
+		line.Reset()
+		line.WriteByte('{')
+		for i, c := range columns {
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			name, _ := json.Marshal(c.Name)
+			value, err := json.Marshal(row[i])
+			if err != nil {
+				return fmt.Errorf("Failed to encode %s => %s", c.Name, err.Error())
+			}
+			line.Write(name)
+			line.WriteByte(':')
+			line.Write(value)
+		}
+		line.WriteString("}\n")
+		if _, err := line.WriteTo(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportSchema describes the exported files, and is written beside them
+type exportSchema struct {
+	Version int                       `json:"version"`
+	Term    string                    `json:"term,omitempty"`
+	Depts   []string                  `json:"departments,omitempty"`
+	Tables  map[string][]exportColumn `json:"tables"`
+	Rows    map[string]string         `json:"rows"` // which rows each table holds
+}
+
+func newExportSchema(tables []exportedTable, term string, depts []string) exportSchema {
+	s := exportSchema{
+		Version: exportSchemaVersion,
+		Term:    term,
+		Depts:   depts,
+		Tables:  make(map[string][]exportColumn),
+		Rows:    make(map[string]string),
+	}
+	for _, t := range tables {
+		s.Tables[t.Name] = t.Columns
+		s.Rows[t.Name] = t.Rows
+	}
+	return s
+}
+
+// writeExportFile() creates the file and writes to it
+func writeExportFile(filename string, write func(io.Writer) error) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to create file, %s, with error: %s", filename, err.Error())
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("Failed to write %s => %s", filename, err.Error())
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Failed to write %s => %s", filename, err.Error())
+	}
+	return nil
+}
+
+// exportTerm() writes each table of the term, in each format, to 'dir' as
+// TABLE.FORMAT along with a schema.json describing them
+func exportTerm(ctx context.Context, db *sql.DB, dir, term string, depts, formats []string, tables []exportedTable) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Failed to create %s => %s", dir, err.Error())
+	}
+
+	for _, t := range tables {
+		rows, err := t.rows(ctx, db, term, depts)
+		if err != nil {
+			return err
+		}
+		for _, format := range formats {
+			filename := filepath.Join(dir, t.Name+"."+format)
+			err := writeExportFile(filename, func(w io.Writer) error {
+				if format == "parquet" {
+					return writeParquet(w, t.Columns, rows)
+				}
+				return writeNDJSON(w, t.Columns, rows)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		slog.Info("exported table", "term", term, "table", t.Name, "rows", len(rows))
+	}
+
+	return writeExportFile(filepath.Join(dir, "schema.json"), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newExportSchema(tables, term, depts))
+	})
+}
+
+// exportCmd() writes the catalog of each term as files for analysis
+func exportCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	terms := flags.String("term", "", "Terms to export, EX: 20143,20151")
+	dir := flags.String("dir", "export", "Directory to write each term's files to, in a directory named for the term")
+	formats := flags.String("format", strings.Join(exportFormats, ","), "Formats to write, ndjson and/or parquet")
+	tableNames := flags.String("tables", "", "Tables to export, of courses, sections and meetings, defaults to all")
+	columns := flags.String("columns", "", "Columns to export, EX: course,term,coursetitle, defaults to all")
+	depts := flags.String("dept", "", "Only export these departments, EX: COMS,MATH")
+	printSchema := flags.Bool("schema", false, "Print the schema of the selected tables and exit")
+	flags.Parse(args)
+
+	tables, err := selectExportTables(lowerList(*tableNames), lowerList(*columns))
+	if err != nil {
+		return err
+	}
+	if *printSchema {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newExportSchema(tables, "", nil))
+	}
+
+	for _, f := range lowerList(*formats) {
+		if !hasString(exportFormats, f) {
+			return fmt.Errorf("unknown export format, %s", f)
+		}
+	}
+	if len(splitList(*terms)) == 0 {
+		return fmt.Errorf("-term must be set")
+	}
+	for _, term := range splitList(*terms) {
+		if _, err := ParseTerm(term); err != nil {
+			return err
+		}
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	for _, term := range splitList(*terms) {
+		err := exportTerm(ctx, db, filepath.Join(*dir, term), term, splitList(*depts), lowerList(*formats), tables)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
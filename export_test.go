@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestExportColumns(t *testing.T) {
+	types := make(map[string]string)
+	for _, table := range exportedTables {
+		for _, c := range table.Columns {
+			types[table.Name+"."+c.Name] = c.Type
+		}
+	}
+	expected := map[string]string{
+		"courses.course":        "string",
+		"courses.numfixedunits": "int64",
+		"courses.description":   "string",
+		"sections.callnumber":   "int64",
+		"sections.numenrolled":  "int64",
+		"sections.starttime1":   "string",
+		"meetings.slot":         "int64",
+	}
+	for column, typ := range expected {
+		if types[column] != typ {
+			t.Errorf("Expected %s to be exported as %s, found %q", column, typ, types[column])
+		}
+	}
+	if len(exportedTables[1].Columns) != len(sectionsTable.columnNames()) {
+		t.Errorf("Expected every stored column of a section to be exported")
+	}
+}
+
+func TestSelectExportTables(t *testing.T) {
+	tables, err := selectExportTables(nil, []string{"course", "numenrolled"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, table := range tables {
+		for _, c := range table.Columns {
+			found = append(found, table.Name+"."+c.Name)
+		}
+	}
+	if strings.Join(found, ",") != "courses.course,sections.numenrolled,sections.course" {
+		t.Errorf("Expected the selected columns of the tables that have them, found %v", found)
+	}
+
+	tables, err = selectExportTables([]string{"meetings"}, nil)
+	if err != nil || len(tables) != 1 || len(tables[0].Columns) != 8 {
+		t.Errorf("Expected every column of meetings, found %v (%v)", tables, err)
+	}
+
+	if _, err := selectExportTables(nil, []string{"course", "nope"}); err == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+	if _, err := selectExportTables([]string{"rooms"}, nil); err == nil {
+		t.Error("Expected an error for an unknown table")
+	}
+	if _, err := selectExportTables([]string{"meetings"}, []string{"numenrolled"}); err == nil {
+		t.Error("Expected an error for a column not in the selected tables")
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	columns := []exportColumn{{Name: "term", Type: "string"}, {Name: "callnumber", Type: "int64"}, {Name: "room", Type: "string"}}
+	var buf bytes.Buffer
+	err := writeNDJSON(&buf, columns, [][]interface{}{
+		{"20143", int64(13704), "833"},
+		{"20143", int64(13705), nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"term":"20143","callnumber":13704,"room":"833"}` + "\n" +
+		`{"term":"20143","callnumber":13705,"room":null}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected\n%s\nfound\n%s", expected, buf.String())
+	}
+}
+
+func TestExportTerm(t *testing.T) {
+	db, mock := newE2EMock(t)
+	mock.MatchExpectationsInOrder(true)
+
+	tables, err := selectExportTables([]string{"sections", "meetings"}, []string{"callnumber", "course", "slot", "weekday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cancelled sections, and their meetings, are left out
+	mock.ExpectQuery(`SELECT callnumber::text, course::text FROM sections_v2_t WHERE term = \$1 AND cancelled_at IS NULL .* ORDER BY callnumber`).
+		WithArgs("20143", "{ACTU}").
+		WillReturnRows(sqlmock.NewRows([]string{"callnumber", "course"}).AddRow("13704", "ACTU4850").AddRow("13705", "ACTU4620"))
+	mock.ExpectQuery(`SELECT callnumber::text, slot::text, weekday::text FROM section_meetings_t .* WHERE term = \$1 AND cancelled_at IS NULL`).
+		WithArgs("20143", "{ACTU}").
+		WillReturnRows(sqlmock.NewRows([]string{"callnumber", "slot", "weekday"}).AddRow("13704", "1", "T").AddRow("13704", "1", "R"))
+
+	dir := filepath.Join(t.TempDir(), "20143")
+	err = exportTerm(context.Background(), db, dir, "20143", []string{"ACTU"}, []string{"ndjson", "parquet"}, tables)
+	if err != nil {
+		t.Fatalf("Failed to export the term => %s", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	sections, err := ioutil.ReadFile(filepath.Join(dir, "sections.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(sections), `{"callnumber":13704,"course":"ACTU4850"}`) {
+		t.Errorf("Expected a line per section, found %s", sections)
+	}
+	meetings, err := ioutil.ReadFile(filepath.Join(dir, "meetings.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(meetings, []byte(parquetMagic)) {
+		t.Error("Expected the meetings to be written as Parquet")
+	}
+
+	var schema exportSchema
+	file, err := ioutil.ReadFile(filepath.Join(dir, "schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(file, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version != exportSchemaVersion || schema.Term != "20143" || len(schema.Tables["meetings"]) != 3 {
+		t.Errorf("Expected the schema of the exported tables, found %+v", schema)
+	}
+	if !strings.Contains(schema.Rows["sections"], "not cancelled") {
+		t.Errorf("Expected the schema to say cancelled sections are left out, found %q", schema.Rows["sections"])
+	}
+}
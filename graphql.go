@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+var graphqlSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	course(course: String!): Course
+	courses(term: String, dept: String, limit: Int, offset: Int): [Course!]!
+	section(term: String!, callNumber: Int!): Section
+	instructor(id: ID!): Instructor
+	term(term: String!): Term!
+	currentTerm: Term
+}
+
+type Course {
+	course: String!
+	courseFull: String!
+	title: String!
+	subtitle: String!
+	description: String!
+	departmentCode: String!
+	departmentName: String!
+	terms: [Term!]!
+	sections(term: String): [Section!]!
+}
+
+type Section {
+	term: Term!
+	callNumber: Int!
+	course: Course
+	campusName: String!
+	typeName: String!
+	numEnrolled: Int!
+	maxSize: Int!
+	meetings: [Meeting!]!
+	instructors: [Instructor!]!
+}
+
+type Meeting {
+	slot: Int!
+	meetsOn: String!
+	weekdays: [String!]!
+	startTime: String!
+	endTime: String!
+	building: String!
+	room: String!
+}
+
+type Instructor {
+	id: ID!
+	name: String!
+	canonical: String!
+	sections(term: String): [Section!]!
+}
+
+type Term {
+	term: String!
+	name: String!
+	year: Int!
+	semester: String!
+	start: String
+	end: String
+	holidays: [String!]!
+	courses(dept: String, limit: Int, offset: Int): [Course!]!
+}
+`
+
+// limits on a GraphQL query, as the schema's types refer to each other and one
+// query could otherwise nest without end, EX: course { sections { course ... } }
+const (
+	graphqlMaxDepth       = 8
+	graphqlMaxQueryLength = 8 << 10
+)
+
+// graphqlInputError is a resolver error caused by the query's arguments, which
+// is shown to the client. Every other resolver error is logged and hidden.
+type graphqlInputError string
+
+func (e graphqlInputError) Error() string { return string(e) }
+
+// graphql() serves POSTed GraphQL queries, with fresh batch loaders for each request
+func (a *api) graphql() http.Handler {
+	schema := graphql.MustParseSchema(graphqlSchema, &queryResolver{a: a}, graphql.MaxDepth(graphqlMaxDepth))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var params struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		body := http.MaxBytesReader(w, r.Body, 2*graphqlMaxQueryLength)
+		if err := json.NewDecoder(body).Decode(&params); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(params.Query) > graphqlMaxQueryLength {
+			http.Error(w, fmt.Sprintf("query must be at most %d bytes", graphqlMaxQueryLength), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), loadersKey{}, newLoaders(a))
+		response := schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+		for _, e := range response.Errors {
+			var input graphqlInputError
+			if e.ResolverError != nil && !errors.As(e.ResolverError, &input) {
+				log.Printf("Error serving %s => %s", r.URL.Path, e.ResolverError.Error())
+				e.Message = "internal error"
+			}
+		}
+		responseJSON, err := json.Marshal(response)
+		if err != nil {
+			apiError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(responseJSON)
+	})
+}
+
+type loadersKey struct{}
+
+// loaders batch the queries made while resolving a single request
+type loaders struct {
+	api                *api
+	courses            *batchLoader // course --> apiCourse
+	courseSections     *batchLoader // course --> []apiSection
+	sectionInstructors *batchLoader // sectionKey --> []apiInstructor
+	instructorSections *batchLoader // instructor id --> []apiSection
+}
+
+func newLoaders(a *api) *loaders {
+	return &loaders{
+		api:                a,
+		courses:            newBatchLoader(a.fetchCourses),
+		courseSections:     newBatchLoader(a.fetchCourseSections),
+		sectionInstructors: newBatchLoader(a.fetchSectionInstructors),
+		instructorSections: newBatchLoader(a.fetchInstructorSections),
+	}
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// sectionKey identifies a section across terms, EX: 20143-13704
+func sectionKey(term, callNumber string) string {
+	return term + "-" + callNumber
+}
+
+// pgTextArray formats keys as a Postgres array literal
+func pgTextArray(keys []string) string {
+	return "{" + strings.Join(keys, ",") + "}"
+}
+
+func (a *api) fetchCourses(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT `+courseColumns+` FROM courses_v2_t WHERE course = ANY($1::text[])`,
+		pgTextArray(keys),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]interface{})
+	for rows.Next() {
+		c, err := scanCourse(rows)
+		if err != nil {
+			return nil, err
+		}
+		values[c.Course] = c
+	}
+	return values, rows.Err()
+}
+
+func (a *api) fetchCourseSections(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	sections, err := a.querySections(ctx,
+		`SELECT `+sectionColumns+`
+		 FROM sections_v2_t S
+		 WHERE S.course = ANY($1::text[]) AND S.cancelled_at IS NULL
+		 ORDER BY S.term DESC, S.callnumber`,
+		pgTextArray(keys),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	for _, s := range sections {
+		list, _ := values[s.Course].([]apiSection)
+		values[s.Course] = append(list, s)
+	}
+	return values, nil
+}
+
+func (a *api) fetchSectionInstructors(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	var terms, callNumbers []string
+	for _, key := range keys {
+		parts := strings.SplitN(key, "-", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid section key, %s", key)
+		}
+		terms = append(terms, parts[0])
+		callNumbers = append(callNumbers, parts[1])
+	}
+
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT SI.term, SI.callnumber, I.id, I.name, I.canonical
+		 FROM section_instructors_t SI JOIN instructors_t I
+		 ON I.id = SI.instructor_id
+		 WHERE (SI.term, SI.callnumber) IN (SELECT * FROM unnest($1::text[], $2::integer[]))
+		 ORDER BY I.name`,
+		pgTextArray(terms), pgTextArray(callNumbers),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]interface{})
+	for rows.Next() {
+		var term, callNumber string
+		var i apiInstructor
+		if err := rows.Scan(&term, &callNumber, &i.ID, &i.Name, &i.Canonical); err != nil {
+			return nil, err
+		}
+		key := sectionKey(term, callNumber)
+		list, _ := values[key].([]apiInstructor)
+		values[key] = append(list, i)
+	}
+	return values, rows.Err()
+}
+
+func (a *api) fetchInstructorSections(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT `+sectionColumns+`, SI.instructor_id
+		 FROM sections_v2_t S JOIN section_instructors_t SI
+		 ON SI.term = S.term AND SI.callnumber = S.callnumber
+		 WHERE SI.instructor_id = ANY($1::integer[]) AND S.cancelled_at IS NULL
+		 ORDER BY S.term DESC, S.course, S.callnumber`,
+		pgTextArray(keys),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]interface{})
+	for rows.Next() {
+		var id string
+		s, err := scanSection(rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		list, _ := values[id].([]apiSection)
+		values[id] = append(list, s)
+	}
+	return values, rows.Err()
+}
+
+// queryResolver resolves the root Query type
+type queryResolver struct {
+	a *api
+}
+
+func (q *queryResolver) Course(ctx context.Context, args struct{ Course string }) (*courseResolver, error) {
+	v, err := loadersFrom(ctx).courses.load(ctx, strings.ToUpper(args.Course))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return newCourseResolvers(ctx, []apiCourse{v.(apiCourse)})[0], nil
+}
+
+type coursesArgs struct {
+	Term   *string
+	Dept   *string
+	Limit  *int32
+	Offset *int32
+}
+
+func (q *queryResolver) Courses(ctx context.Context, args coursesArgs) ([]*courseResolver, error) {
+	var term, dept string
+	if args.Term != nil {
+		term = *args.Term
+	}
+	if args.Dept != nil {
+		dept = strings.ToUpper(*args.Dept)
+	}
+	limit, offset := defaultPageSize, 0
+	if args.Limit != nil {
+		limit = int(*args.Limit)
+	}
+	if args.Offset != nil {
+		offset = int(*args.Offset)
+	}
+	if limit < 1 || limit > maxPageSize {
+		return nil, graphqlInputError(fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+	}
+	if offset < 0 {
+		return nil, graphqlInputError("offset must be a positive number")
+	}
+
+	rows, err := q.a.db.QueryContext(ctx,
+		`SELECT `+courseColumns+`
+		 FROM courses_v2_t C
+		 WHERE ($1 = '' OR EXISTS (SELECT 1 FROM course_terms_t T WHERE T.course = C.course AND T.term = $1))
+			AND ($2 = '' OR C.departmentcode = $2)
+		 ORDER BY C.course
+		 LIMIT $3 OFFSET $4`,
+		term, dept, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []apiCourse
+	for rows.Next() {
+		c, err := scanCourse(rows)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newCourseResolvers(ctx, courses), nil
+}
+
+func (q *queryResolver) Section(ctx context.Context, args struct {
+	Term       string
+	CallNumber int32
+}) (*sectionResolver, error) {
+	sections, err := q.a.querySections(ctx,
+		`SELECT `+sectionColumns+` FROM sections_v2_t S WHERE S.term = $1 AND S.callnumber = $2`,
+		args.Term, args.CallNumber,
+	)
+	if err != nil || len(sections) == 0 {
+		return nil, err
+	}
+	return newSectionResolvers(ctx, sections)[0], nil
+}
+
+func (q *queryResolver) Instructor(ctx context.Context, args struct{ ID graphql.ID }) (*instructorResolver, error) {
+	id, err := strconv.ParseInt(string(args.ID), 10, 64)
+	if err != nil {
+		return nil, graphqlInputError("id must be a number")
+	}
+
+	var i apiInstructor
+	err = q.a.db.QueryRowContext(ctx,
+		`SELECT id, name, canonical FROM instructors_t WHERE id = $1`, id,
+	).Scan(&i.ID, &i.Name, &i.Canonical)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return newInstructorResolvers(ctx, []apiInstructor{i})[0], nil
+}
+
+func (q *queryResolver) Term(args struct{ Term string }) (*termResolver, error) {
+	if _, err := ParseTerm(args.Term); err != nil {
+		return nil, graphqlInputError(err.Error())
+	}
+	return &termResolver{term: args.Term}, nil
+}
+
+// CurrentTerm is the term in session, or the next to start, per the term calendar
+func (q *queryResolver) CurrentTerm() *termResolver {
+	code, ok := q.a.terms.current(time.Now())
+	if !ok {
+		return nil
+	}
+	return &termResolver{term: code}
+}
+
+type courseResolver struct {
+	c apiCourse
+}
+
+// newCourseResolvers() queues the courses' sections to load together
+func newCourseResolvers(ctx context.Context, courses []apiCourse) []*courseResolver {
+	l := loadersFrom(ctx)
+	resolvers := make([]*courseResolver, len(courses))
+	for i, c := range courses {
+		l.courses.prime(c.Course, c)
+		l.courseSections.queue(c.Course)
+		resolvers[i] = &courseResolver{c: c}
+	}
+	return resolvers
+}
+
+func (r *courseResolver) Course() string         { return r.c.Course }
+func (r *courseResolver) CourseFull() string     { return r.c.CourseFull }
+func (r *courseResolver) Title() string          { return r.c.CourseTitle }
+func (r *courseResolver) Subtitle() string       { return r.c.CourseSubtitle }
+func (r *courseResolver) Description() string    { return r.c.Description }
+func (r *courseResolver) DepartmentCode() string { return r.c.DepartmentCode }
+func (r *courseResolver) DepartmentName() string { return r.c.DepartmentName }
+
+func (r *courseResolver) sections(ctx context.Context) ([]apiSection, error) {
+	v, err := loadersFrom(ctx).courseSections.load(ctx, r.c.Course)
+	sections, _ := v.([]apiSection)
+	return sections, err
+}
+
+// Terms lists the terms the course has sections in, newest first
+func (r *courseResolver) Terms(ctx context.Context) ([]*termResolver, error) {
+	sections, err := r.sections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	terms := []*termResolver{}
+	for _, s := range sections {
+		if len(terms) == 0 || terms[len(terms)-1].term != s.Term {
+			terms = append(terms, &termResolver{term: s.Term})
+		}
+	}
+	return terms, nil
+}
+
+func (r *courseResolver) Sections(ctx context.Context, args struct{ Term *string }) ([]*sectionResolver, error) {
+	sections, err := r.sections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newSectionResolvers(ctx, sectionsInTerm(sections, args.Term)), nil
+}
+
+// sectionsInTerm() filters sections by the optional 'term' argument
+func sectionsInTerm(sections []apiSection, term *string) []apiSection {
+	if term == nil {
+		return sections
+	}
+	var inTerm []apiSection
+	for _, s := range sections {
+		if s.Term == *term {
+			inTerm = append(inTerm, s)
+		}
+	}
+	return inTerm
+}
+
+type sectionResolver struct {
+	s apiSection
+}
+
+// newSectionResolvers() queues the sections' courses and instructors to load together
+func newSectionResolvers(ctx context.Context, sections []apiSection) []*sectionResolver {
+	l := loadersFrom(ctx)
+	resolvers := make([]*sectionResolver, len(sections))
+	for i, s := range sections {
+		l.courses.queue(s.Course)
+		l.sectionInstructors.queue(sectionKey(s.Term, s.CallNumber))
+		resolvers[i] = &sectionResolver{s: s}
+	}
+	return resolvers
+}
+
+// atoi32() reads the numeric string columns of a section
+func atoi32(s string) int32 {
+	n, _ := strconv.Atoi(s)
+	return int32(n)
+}
+
+func (r *sectionResolver) Term() *termResolver {
+	return &termResolver{term: r.s.Term}
+}
+func (r *sectionResolver) CallNumber() int32  { return atoi32(r.s.CallNumber) }
+func (r *sectionResolver) CampusName() string { return r.s.CampusName }
+func (r *sectionResolver) TypeName() string   { return r.s.TypeName }
+func (r *sectionResolver) NumEnrolled() int32 { return atoi32(r.s.NumEnrolled) }
+func (r *sectionResolver) MaxSize() int32     { return atoi32(r.s.MaxSize) }
+
+func (r *sectionResolver) Course(ctx context.Context) (*courseResolver, error) {
+	v, err := loadersFrom(ctx).courses.load(ctx, r.s.Course)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return &courseResolver{c: v.(apiCourse)}, nil
+}
+
+func (r *sectionResolver) Meetings() []*meetingResolver {
+	meetings := make([]*meetingResolver, len(r.s.Meetings))
+	for i, m := range r.s.Meetings {
+		meetings[i] = &meetingResolver{m: m}
+	}
+	return meetings
+}
+
+func (r *sectionResolver) Instructors(ctx context.Context) ([]*instructorResolver, error) {
+	v, err := loadersFrom(ctx).sectionInstructors.load(ctx, sectionKey(r.s.Term, r.s.CallNumber))
+	if err != nil {
+		return nil, err
+	}
+	instructors, _ := v.([]apiInstructor)
+	return newInstructorResolvers(ctx, instructors), nil
+}
+
+type meetingResolver struct {
+	m Meeting
+}
+
+func (r *meetingResolver) Slot() int32       { return int32(r.m.Slot) }
+func (r *meetingResolver) MeetsOn() string   { return r.m.MeetsOn }
+func (r *meetingResolver) StartTime() string { return r.m.StartTime }
+func (r *meetingResolver) EndTime() string   { return r.m.EndTime }
+func (r *meetingResolver) Building() string  { return r.m.Building }
+func (r *meetingResolver) Room() string      { return r.m.Room }
+
+// Weekdays names the days of the week, EX: ["Tuesday", "Thursday"]
+func (r *meetingResolver) Weekdays() []string {
+	days := []string{}
+	for _, day := range r.m.Weekdays() {
+		days = append(days, day.String())
+	}
+	return days
+}
+
+type instructorResolver struct {
+	i apiInstructor
+}
+
+// newInstructorResolvers() queues the instructors' sections to load together
+func newInstructorResolvers(ctx context.Context, instructors []apiInstructor) []*instructorResolver {
+	l := loadersFrom(ctx)
+	resolvers := make([]*instructorResolver, len(instructors))
+	for i, in := range instructors {
+		l.instructorSections.queue(strconv.FormatInt(in.ID, 10))
+		resolvers[i] = &instructorResolver{i: in}
+	}
+	return resolvers
+}
+
+func (r *instructorResolver) ID() graphql.ID    { return graphql.ID(strconv.FormatInt(r.i.ID, 10)) }
+func (r *instructorResolver) Name() string      { return r.i.Name }
+func (r *instructorResolver) Canonical() string { return r.i.Canonical }
+
+func (r *instructorResolver) Sections(ctx context.Context, args struct{ Term *string }) ([]*sectionResolver, error) {
+	v, err := loadersFrom(ctx).instructorSections.load(ctx, strconv.FormatInt(r.i.ID, 10))
+	if err != nil {
+		return nil, err
+	}
+	sections, _ := v.([]apiSection)
+	return newSectionResolvers(ctx, sectionsInTerm(sections, args.Term)), nil
+}
+
+type termResolver struct {
+	term string
+}
+
+func (r *termResolver) Term() string { return r.term }
+
+// decoded() is the term's apiTerm, section terms were validated when loaded
+func (r *termResolver) decoded(ctx context.Context) apiTerm {
+	t, _ := loadersFrom(ctx).api.describeTerm(r.term)
+	return t
+}
+
+func (r *termResolver) Name(ctx context.Context) string { return r.decoded(ctx).Name }
+
+func (r *termResolver) Year() int32 {
+	t, _ := ParseTerm(r.term)
+	return int32(t.Year)
+}
+
+func (r *termResolver) Semester() string {
+	t, _ := ParseTerm(r.term)
+	return t.Semester.String()
+}
+
+// optionalString() is nil for an empty string
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func (r *termResolver) Start(ctx context.Context) *string {
+	return optionalString(r.decoded(ctx).Start)
+}
+
+func (r *termResolver) End(ctx context.Context) *string {
+	return optionalString(r.decoded(ctx).End)
+}
+
+func (r *termResolver) Holidays(ctx context.Context) []string {
+	if h := r.decoded(ctx).Holidays; h != nil {
+		return h
+	}
+	return []string{}
+}
+
+func (r *termResolver) Courses(ctx context.Context, args struct {
+	Dept   *string
+	Limit  *int32
+	Offset *int32
+}) ([]*courseResolver, error) {
+	q := &queryResolver{a: loadersFrom(ctx).api}
+	return q.Courses(ctx, coursesArgs{Term: &r.term, Dept: args.Dept, Limit: args.Limit, Offset: args.Offset})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBatchLoader(t *testing.T) {
+	var fetched [][]string
+	l := newBatchLoader(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		fetched = append(fetched, keys)
+		values := make(map[string]interface{})
+		for _, k := range keys {
+			if k != "MISSING" {
+				values[k] = strings.ToLower(k)
+			}
+		}
+		return values, nil
+	})
+
+	// a parent resolver queues its items' keys, the first load fetches them all
+	l.queue("COMS4118", "COMS4111", "MISSING", "COMS4118")
+	l.prime("COMS3157", "primed")
+	for _, key := range []string{"COMS4111", "COMS4118", "MISSING", "COMS3157"} {
+		if _, err := l.load(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l.batches != 1 {
+		t.Fatalf("Expected a single batch, found %d: %v", l.batches, fetched)
+	}
+	keys := fetched[0]
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "COMS4111,COMS4118,MISSING" {
+		t.Errorf("Expected the queued keys to be fetched once each, found %v", keys)
+	}
+
+	if v, _ := l.load(context.Background(), "MISSING"); v != nil {
+		t.Errorf("Expected nil for a missing key, found %v", v)
+	}
+	if v, _ := l.load(context.Background(), "COMS3157"); v != "primed" {
+		t.Errorf("Expected the primed value, found %v", v)
+	}
+	if v, _ := l.load(context.Background(), "COMS1004"); v != "coms1004" || l.batches != 2 {
+		t.Errorf("Expected an unqueued key to be fetched on its own, found %v after %d batches", v, l.batches)
+	}
+}
+
+func TestGraphQLHandler(t *testing.T) {
+	// the schema is checked against the resolvers when parsed
+	h := (&api{terms: testTermCalendar}).graphql()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, found %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	body := `{"query": "{ term(term: \"20143\") { term name year semester start end } }"}`
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", strings.NewReader(body)))
+	expected := `{"data":{"term":{"term":"20143","name":"Fall 2014","year":2014,"semester":"Fall","start":"2014-09-03","end":"2014-12-12"}}}`
+	if got := rec.Body.String(); got != expected {
+		t.Errorf("Unexpected response, %s", got)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := (&api{db: db, terms: testTermCalendar}).graphql()
+	post := func(query string) string {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+		return rec.Body.String()
+	}
+
+	// queries nesting deeper than the limit are rejected before resolving
+	deep := `{ course(course: "COMS4118") { sections { course { sections { course { sections { course { sections { term { term } } } } } } } } } }`
+	if got := post(deep); !strings.Contains(got, "exceeds max depth") {
+		t.Errorf("Expected a query past the maximum depth to be rejected, found %s", got)
+	}
+	if got := post("{ " + strings.Repeat(" ", graphqlMaxQueryLength) + "currentTerm { term } }"); !strings.Contains(got, "query must be at most") {
+		t.Errorf("Expected a long query to be rejected, found %s", got)
+	}
+
+	// arguments are validated, and database errors are hidden
+	if got := post(`{ instructor(id: "abc") { name } }`); !strings.Contains(got, `"message":"id must be a number"`) {
+		t.Errorf("Expected a non-numeric id to be rejected, found %s", got)
+	}
+	mock.ExpectQuery(`FROM instructors_t WHERE id = \$1`).WithArgs(7).
+		WillReturnError(fmt.Errorf(`pq: invalid input syntax for integer: "abc"`))
+	if got := post(`{ instructor(id: "7") { name } }`); !strings.Contains(got, `"message":"internal error"`) || strings.Contains(got, "pq:") {
+		t.Errorf("Expected the database error to be hidden, found %s", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
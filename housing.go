@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var housingType = "rooms"
+
+// HousingRoom holds a room from the housing export, stored in 'housing_t'
+type HousingRoom struct {
+	RoomLocationArea         string
+	ResidentialArea          string
+	RoomLocation             string // the building, EX: Wien Hall
+	RoomLocationSection      string
+	RoomLocationFloorSuite   string
+	IsSuite                  bool
+	FloorSuiteWebDescription string
+	Room                     string
+	RoomArea                 int
+	RoomSpace                string
+	RoomType                 string
+	AY1213RSStatus           string
+	PointValue               float64
+	LotteryNumber            int
+}
+
+// HousingAmenities holds a building's amenities, stored in 'housing_amenities_t'
+type HousingAmenities struct {
+	Building            string
+	ApartmentStyle      bool
+	SuiteStyle          bool
+	CorridorStyle       bool
+	PrivateBathroom     bool
+	SemiPrivateBathroom bool
+	SharedBathroom      bool
+	PrivateKitchen      bool
+	SemiPrivateKitchen  bool
+	SharedKitchen       bool
+	Lounge              string
+}
+
+// housingRecord is a row of an export keyed by lowercased column name with
+// spaces and underscores removed, EX: "Room Location" => "roomlocation"
+type housingRecord map[string]string
+
+func housingKey(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.TrimSpace(s)))
+}
+
+// readHousingRecords() reads a CSV export with a header row, or a JSON array
+// of objects, depending on the file's extension
+func readHousingRecords(r io.Reader, ext string) ([]housingRecord, error) {
+	var records []housingRecord
+	switch strings.ToLower(ext) {
+	case ".csv":
+		rows, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV => %s", err.Error())
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		header := rows[0]
+		for _, row := range rows[1:] {
+			rec := make(housingRecord)
+			for i, col := range header {
+				if i < len(row) {
+					rec[housingKey(col)] = strings.TrimSpace(row[i])
+				}
+			}
+			records = append(records, rec)
+		}
+
+	case ".json":
+		var objects []map[string]interface{}
+		dec := json.NewDecoder(r)
+		dec.UseNumber() // so 1000000 is read as written, not as 1e+06
+		if err := dec.Decode(&objects); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON => %s", err.Error())
+		}
+		for _, obj := range objects {
+			rec := make(housingRecord)
+			for k, v := range obj {
+				switch v := v.(type) {
+				case nil:
+				case json.Number:
+					rec[housingKey(k)] = v.String()
+				default:
+					rec[housingKey(k)] = strings.TrimSpace(fmt.Sprint(v))
+				}
+			}
+			records = append(records, rec)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown housing export format, %s", ext)
+	}
+	return records, nil
+}
+
+// the longest text the housing tables' varchar(32) columns hold
+const housingTextLength = 32
+
+// helpers that collect the first error while reading a record
+type recordReader struct {
+	rec housingRecord
+	err error
+}
+
+func (r *recordReader) string(key string) string {
+	if utf8.RuneCountInString(r.rec[key]) > housingTextLength && r.err == nil {
+		r.err = fmt.Errorf("%s is longer than %d characters, %q", key, housingTextLength, r.rec[key])
+	}
+	return r.rec[key]
+}
+
+func (r *recordReader) bool(key string) bool {
+	switch strings.ToLower(r.rec[key]) {
+	case "", "0", "f", "false", "n", "no":
+		return false
+	case "1", "t", "true", "y", "yes":
+		return true
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("%s is not a boolean, %q", key, r.rec[key])
+	}
+	return false
+}
+
+func (r *recordReader) int(key string) int {
+	if r.rec[key] == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(r.rec[key])
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("%s is not a number, %q", key, r.rec[key])
+	}
+	return n
+}
+
+func (r *recordReader) float(key string) float64 {
+	if r.rec[key] == "" {
+		return 0
+	}
+	n, err := strconv.ParseFloat(r.rec[key], 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("%s is not a number, %q", key, r.rec[key])
+	}
+	return n
+}
+
+// parseHousingRoom() reads and validates a room
+func parseHousingRoom(rec housingRecord) (HousingRoom, error) {
+	r := recordReader{rec: rec}
+	room := HousingRoom{
+		RoomLocationArea:         r.string("roomlocationarea"),
+		ResidentialArea:          r.string("residentialarea"),
+		RoomLocation:             r.string("roomlocation"),
+		RoomLocationSection:      r.string("roomlocationsection"),
+		RoomLocationFloorSuite:   r.string("roomlocationfloorsuite"),
+		IsSuite:                  r.bool("issuite"),
+		FloorSuiteWebDescription: r.string("floorsuitewebdescription"),
+		Room:                     r.string("room"),
+		RoomArea:                 r.int("roomarea"),
+		RoomSpace:                r.string("roomspace"),
+		RoomType:                 r.string("roomtype"),
+		AY1213RSStatus:           r.string("ay1213rsstatus"),
+		PointValue:               r.float("pointvalue"),
+		LotteryNumber:            r.int("lotterynumber"),
+	}
+	if r.err != nil {
+		return room, r.err
+	}
+
+	switch {
+	case room.RoomLocation == "" || room.Room == "":
+		return room, fmt.Errorf("a room needs both a RoomLocation and a Room")
+	case room.RoomArea < 0 || room.PointValue < 0 || room.LotteryNumber < 0:
+		return room, fmt.Errorf("%s %s has a negative area, point value or lottery number", room.RoomLocation, room.Room)
+	}
+	return room, nil
+}
+
+// parseHousingAmenities() reads and validates a building's amenities
+func parseHousingAmenities(rec housingRecord) (HousingAmenities, error) {
+	r := recordReader{rec: rec}
+	a := HousingAmenities{
+		Building:            r.string("building"),
+		ApartmentStyle:      r.bool("apartmentstyle"),
+		SuiteStyle:          r.bool("suitestyle"),
+		CorridorStyle:       r.bool("corridorstyle"),
+		PrivateBathroom:     r.bool("privatebathroom"),
+		SemiPrivateBathroom: r.bool("semiprivatebathroom"),
+		SharedBathroom:      r.bool("sharedbathroom"),
+		PrivateKitchen:      r.bool("privatekitchen"),
+		SemiPrivateKitchen:  r.bool("semiprivatekitchen"),
+		SharedKitchen:       r.bool("sharedkitchen"),
+		Lounge:              r.string("lounge"),
+	}
+	if r.err != nil {
+		return a, r.err
+	}
+	if a.Building == "" {
+		return a, fmt.Errorf("amenities need a Building")
+	}
+	return a, nil
+}
+
+// Upsert inserts the room to the 'housing_t' database, updating it if it exists
+func (h HousingRoom) Upsert(ctx context.Context, db execer) error {
+	query := `INSERT INTO housing_t (
+	roomlocationarea,
+	residentialarea,
+	roomlocation,
+	roomlocationsection,
+	roomlocationfloorsuite,
+	issuite,
+	floorsuitewebdescription,
+	room,
+	roomarea,
+	roomspace,
+	roomtype,
+	ay1213rsstatus,
+	pointvalue,
+	lotterynumber
+	) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9,
+	$10,
+	$11,
+	$12,
+	$13,
+	$14
+	) ON CONFLICT (roomlocation, room) DO UPDATE SET
+	roomlocationarea = EXCLUDED.roomlocationarea,
+	residentialarea = EXCLUDED.residentialarea,
+	roomlocationsection = EXCLUDED.roomlocationsection,
+	roomlocationfloorsuite = EXCLUDED.roomlocationfloorsuite,
+	issuite = EXCLUDED.issuite,
+	floorsuitewebdescription = EXCLUDED.floorsuitewebdescription,
+	roomarea = EXCLUDED.roomarea,
+	roomspace = EXCLUDED.roomspace,
+	roomtype = EXCLUDED.roomtype,
+	ay1213rsstatus = EXCLUDED.ay1213rsstatus,
+	pointvalue = EXCLUDED.pointvalue,
+	lotterynumber = EXCLUDED.lotterynumber`
+	_, err := db.ExecContext(
+		ctx,
+		query,
+		h.RoomLocationArea,
+		h.ResidentialArea,
+		h.RoomLocation,
+		h.RoomLocationSection,
+		h.RoomLocationFloorSuite,
+		h.IsSuite,
+		h.FloorSuiteWebDescription,
+		h.Room,
+		h.RoomArea,
+		h.RoomSpace,
+		h.RoomType,
+		h.AY1213RSStatus,
+		h.PointValue,
+		h.LotteryNumber,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to upsert housing_t, %#v, => %s", h, err.Error())
+	}
+	return nil
+}
+
+// Upsert inserts the amenities to the 'housing_amenities_t' database, updating them if they exist
+func (a HousingAmenities) Upsert(ctx context.Context, db execer) error {
+	query := `INSERT INTO housing_amenities_t (
+	building,
+	apartmentstyle,
+	suitestyle,
+	corridorstyle,
+	privatebathroom,
+	semiprivatebathroom,
+	sharedbathroom,
+	privatekitchen,
+	semiprivatekitchen,
+	sharedkitchen,
+	lounge
+	) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	$9,
+	$10,
+	$11
+	) ON CONFLICT (building) DO UPDATE SET
+	apartmentstyle = EXCLUDED.apartmentstyle,
+	suitestyle = EXCLUDED.suitestyle,
+	corridorstyle = EXCLUDED.corridorstyle,
+	privatebathroom = EXCLUDED.privatebathroom,
+	semiprivatebathroom = EXCLUDED.semiprivatebathroom,
+	sharedbathroom = EXCLUDED.sharedbathroom,
+	privatekitchen = EXCLUDED.privatekitchen,
+	semiprivatekitchen = EXCLUDED.semiprivatekitchen,
+	sharedkitchen = EXCLUDED.sharedkitchen,
+	lounge = EXCLUDED.lounge`
+	_, err := db.ExecContext(
+		ctx,
+		query,
+		a.Building,
+		a.ApartmentStyle,
+		a.SuiteStyle,
+		a.CorridorStyle,
+		a.PrivateBathroom,
+		a.SemiPrivateBathroom,
+		a.SharedBathroom,
+		a.PrivateKitchen,
+		a.SemiPrivateKitchen,
+		a.SharedKitchen,
+		a.Lounge,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to upsert housing_amenities_t, %#v, => %s", a, err.Error())
+	}
+	return nil
+}
+
+// openHousingExport() reads the records of an export file
+func openHousingExport(filename string) ([]housingRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file, %s, with error: %s", filename, err.Error())
+	}
+	defer file.Close()
+	return readHousingRecords(file, filepath.Ext(filename))
+}
+
+// loadHousing() validates then upserts the rooms and amenities exports in a
+// single transaction. Invalid records are logged and skipped.
+func loadHousing(ctx context.Context, db *sql.DB, roomsFile, amenitiesFile string) error {
+	var rooms []HousingRoom
+	var amenities []HousingAmenities
+
+	if roomsFile != "" {
+		records, err := openHousingExport(roomsFile)
+		if err != nil {
+			return err
+		}
+		for i, rec := range records {
+			room, err := parseHousingRoom(rec)
+			if err != nil {
+				log.Printf("skipping room on row %d, %s", i+1, err.Error())
+				continue
+			}
+			rooms = append(rooms, room)
+		}
+	}
+	if amenitiesFile != "" {
+		records, err := openHousingExport(amenitiesFile)
+		if err != nil {
+			return err
+		}
+		for i, rec := range records {
+			a, err := parseHousingAmenities(rec)
+			if err != nil {
+				log.Printf("skipping amenities on row %d, %s", i+1, err.Error())
+				continue
+			}
+			amenities = append(amenities, a)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+	for _, a := range amenities {
+		if err := a.Upsert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	for _, room := range rooms {
+		if err := room.Upsert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit housing => %s", err.Error())
+	}
+	log.Printf("Loaded %d rooms and %d buildings' amenities", len(rooms), len(amenities))
+	return nil
+}
+
+// esHousingData is a room search document, the room joined with its building's amenities
+type esHousingData struct {
+	HousingRoom
+	Amenities *HousingAmenities `json:",omitempty"`
+}
+
+var esHousingQuery = `
+SELECT
+	coalesce(H.roomlocationarea, ''),
+	coalesce(H.residentialarea, ''),
+	H.roomlocation,
+	coalesce(H.roomlocationsection, ''),
+	coalesce(H.roomlocationfloorsuite, ''),
+	coalesce(H.issuite, false),
+	coalesce(H.floorsuitewebdescription, ''),
+	H.room,
+	coalesce(H.roomarea, 0),
+	coalesce(H.roomspace, ''),
+	coalesce(H.roomtype, ''),
+	coalesce(H.ay1213rsstatus, ''),
+	coalesce(H.pointvalue, 0),
+	coalesce(H.lotterynumber, 0),
+	A.building IS NOT NULL,
+	coalesce(A.apartmentstyle, false),
+	coalesce(A.suitestyle, false),
+	coalesce(A.corridorstyle, false),
+	coalesce(A.privatebathroom, false),
+	coalesce(A.semiprivatebathroom, false),
+	coalesce(A.sharedbathroom, false),
+	coalesce(A.privatekitchen, false),
+	coalesce(A.semiprivatekitchen, false),
+	coalesce(A.sharedkitchen, false),
+	coalesce(A.lounge, '')
+ FROM housing_t H LEFT JOIN housing_amenities_t A
+ ON A.building = H.roomlocation
+`
+
+// updateHousingES() rebuilds the room search index from the database
+func updateHousingES(ctx context.Context, db *sql.DB, index string) error {
+	if err := deleteIndex(ctx, index); err != nil {
+		log.Printf("WARNING: %s", err.Error())
+	}
+	if err := createIndex(ctx, index); err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, esHousingQuery)
+	if err != nil {
+		return fmt.Errorf("Error while querying Postgres for housing ES data => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var batch bulkInsert
+	for rows.Next() {
+		var d esHousingData
+		var a HousingAmenities
+		var hasAmenities bool
+		err := rows.Scan(
+			&d.RoomLocationArea,
+			&d.ResidentialArea,
+			&d.RoomLocation,
+			&d.RoomLocationSection,
+			&d.RoomLocationFloorSuite,
+			&d.IsSuite,
+			&d.FloorSuiteWebDescription,
+			&d.Room,
+			&d.RoomArea,
+			&d.RoomSpace,
+			&d.RoomType,
+			&d.AY1213RSStatus,
+			&d.PointValue,
+			&d.LotteryNumber,
+			&hasAmenities,
+			&a.ApartmentStyle,
+			&a.SuiteStyle,
+			&a.CorridorStyle,
+			&a.PrivateBathroom,
+			&a.SemiPrivateBathroom,
+			&a.SharedBathroom,
+			&a.PrivateKitchen,
+			&a.SemiPrivateKitchen,
+			&a.SharedKitchen,
+			&a.Lounge,
+		)
+		if err != nil {
+			return fmt.Errorf("Error while processing housing data => %s", err.Error())
+		}
+		if hasAmenities {
+			a.Building = d.RoomLocation
+			d.Amenities = &a
+		}
+
+		batch = append(batch, bulkItem{
+			Index: esAction{Index: esMetadata{Index: index, Type: housingType, ID: d.RoomLocation + " " + d.Room}},
+			Data:  d,
+		})
+		if len(batch) == batchSize {
+			if err := insertEsData(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Error while reading housing data => %s", err.Error())
+	}
+	return insertEsData(ctx, batch)
+}
+
+// housingCmd() loads the housing exports then reindexes room search
+func housingCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("housing", flag.ExitOnError)
+	roomsFile := flags.String("rooms", "", "CSV or JSON export of rooms")
+	amenitiesFile := flags.String("amenities", "", "CSV or JSON export of building amenities")
+	index := flags.String("es-index", "housing", "ES index for room search")
+	skipES := flags.Bool("skip-es", false, "Skip running the ES index updates")
+	flags.Parse(args)
+	if *roomsFile == "" && *amenitiesFile == "" {
+		return fmt.Errorf("-rooms or -amenities must be set")
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	if err := loadHousing(ctx, db, *roomsFile, *amenitiesFile); err != nil {
+		return err
+	}
+	if *skipES {
+		return nil
+	}
+	return updateHousingES(ctx, db, *index)
+}
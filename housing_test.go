@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testRoomsCSV = `Room Location Area,Residential Area,Room Location,Is Suite,Room,Room Area,Room Type,Point Value,Lottery Number
+Morningside,Upperclass,Wien Hall,false,211,140,Single,20.5,1042
+Morningside,Upperclass,Wien Hall,maybe,212,140,Single,20.5,1043
+Morningside,Upperclass,,false,213,140,Single,20.5,1044
+Morningside,Upperclass,Ruggles Hall,true,1021A,-5,Suite,18,200
+`
+
+func TestParseHousingRoomsCSV(t *testing.T) {
+	records, err := readHousingRecords(strings.NewReader(testRoomsCSV), ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records, found %d", len(records))
+	}
+
+	room, err := parseHousingRoom(records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := HousingRoom{
+		RoomLocationArea: "Morningside",
+		ResidentialArea:  "Upperclass",
+		RoomLocation:     "Wien Hall",
+		Room:             "211",
+		RoomArea:         140,
+		RoomType:         "Single",
+		PointValue:       20.5,
+		LotteryNumber:    1042,
+	}
+	if room != expected {
+		t.Errorf("Expected %#v, found %#v", expected, room)
+	}
+
+	// not a boolean, no building, negative area
+	for _, rec := range records[1:] {
+		if room, err := parseHousingRoom(rec); err == nil {
+			t.Errorf("Expected an invalid room, found %#v", room)
+		}
+	}
+}
+
+func TestParseHousingAmenitiesJSON(t *testing.T) {
+	input := `[
+		{"Building": "Wien Hall", "Corridor_Style": true, "Shared_Bathroom": "yes", "Lounge": "Floor", "Shared_Kitchen": 1},
+		{"Building": "", "Suite_Style": true}
+	]`
+	records, err := readHousingRecords(strings.NewReader(input), ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := parseHousingAmenities(records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := HousingAmenities{Building: "Wien Hall", CorridorStyle: true, SharedBathroom: true, SharedKitchen: true, Lounge: "Floor"}
+	if a != expected {
+		t.Errorf("Expected %#v, found %#v", expected, a)
+	}
+
+	if a, err := parseHousingAmenities(records[1]); err == nil {
+		t.Errorf("Expected amenities without a building to be invalid, found %#v", a)
+	}
+
+	if _, err := readHousingRecords(strings.NewReader(input), ".xml"); err == nil {
+		t.Error("Expected an unknown format to fail")
+	}
+}
+
+func TestParseHousingRoomsJSON(t *testing.T) {
+	input := `[
+		{"Room Location": "Wien Hall", "Room": 211, "Lottery Number": 1000000, "Point Value": 2.5},
+		{"Room Location": "Wien Hall", "Room": "212", "Room Type": "` + strings.Repeat("x", housingTextLength+1) + `"}
+	]`
+	records, err := readHousingRecords(strings.NewReader(input), ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// numbers are read as written, not in exponent form
+	room, err := parseHousingRoom(records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.Room != "211" || room.LotteryNumber != 1000000 || room.PointValue != 2.5 {
+		t.Errorf("Expected the room's numbers as written, found %#v", room)
+	}
+
+	// text too long for its column makes only its row invalid
+	if room, err := parseHousingRoom(records[1]); err == nil || !strings.Contains(err.Error(), "roomtype") {
+		t.Errorf("Expected a room type longer than its column to be invalid, found %#v, %v", room, err)
+	}
+}
+
+func TestHousingESDocument(t *testing.T) {
+	d := esHousingData{HousingRoom: HousingRoom{RoomLocation: "Wien Hall", Room: "211"}}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "Amenities") || !strings.Contains(string(b), `"RoomLocation":"Wien Hall"`) {
+		t.Errorf("Expected a flat room document without amenities, found %s", b)
+	}
+}
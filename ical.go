@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // so the calendar zone exists wherever this runs
+	"unicode/utf8"
+)
+
+// sections meet in New York time
+var calendarTZ = "America/New_York"
+
+// the VTIMEZONE events' TZID refers to
+var calendarTimezone = []string{
+	"BEGIN:VTIMEZONE",
+	"TZID:America/New_York",
+	"BEGIN:DAYLIGHT",
+	"TZOFFSETFROM:-0500",
+	"TZOFFSETTO:-0400",
+	"TZNAME:EDT",
+	"DTSTART:19700308T020000",
+	"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU",
+	"END:DAYLIGHT",
+	"BEGIN:STANDARD",
+	"TZOFFSETFROM:-0400",
+	"TZOFFSETTO:-0500",
+	"TZNAME:EST",
+	"DTSTART:19701101T020000",
+	"RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU",
+	"END:STANDARD",
+	"END:VTIMEZONE",
+}
+
+// RFC 5545 weekday names
+var icalWeekdays = map[time.Weekday]string{
+	time.Sunday:    "SU",
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+}
+
+// calendarSection is a section along with its course's title and the days
+// its classes are held
+type calendarSection struct {
+	apiSection
+	Title       string
+	SubtermCode string
+	Bounds      termBounds
+}
+
+// termBounds are the first and last days of classes and the holidays between them
+type termBounds struct {
+	Start, End time.Time
+	Holidays   []time.Time
+}
+
+// icsWriter writes content lines, keeping the first error
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+// line() writes a content line, folded to 75 octets as RFC 5545 asks
+func (w *icsWriter) line(s string) {
+	if w.err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	for len(s) > 75 {
+		cut := 75
+		if buf.Len() > 0 {
+			cut = 74 // the leading space of a continuation counts
+		}
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		buf.WriteString(s[:cut])
+		buf.WriteString("\r\n ")
+		s = s[cut:]
+	}
+	buf.WriteString(s)
+	buf.WriteString("\r\n")
+	_, w.err = w.w.Write(buf.Bytes())
+}
+
+// icalText() escapes a TEXT value
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icalLocalTime() formats a date and an "HH:MM:SS" time of day as a local DATE-TIME
+func icalLocalTime(day time.Time, clock string) string {
+	return day.Format("20060102") + "T" + strings.Replace(clock, ":", "", -1)
+}
+
+// firstMeeting() is the first day on or after 'start' that the meeting is held
+func firstMeeting(start time.Time, days []time.Weekday) (time.Time, bool) {
+	for i := 0; i < 7; i++ {
+		d := start.AddDate(0, 0, i)
+		for _, day := range days {
+			if d.Weekday() == day {
+				return d, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s calendarSection) summary() string {
+	if s.Title == "" {
+		return s.Course
+	}
+	return s.Course + " " + s.Title
+}
+
+func (m Meeting) location() string {
+	return strings.TrimSpace(m.Building + " " + m.Room)
+}
+
+// writeCalendar() writes the sections as an RFC 5545 calendar. Each meeting
+// is a weekly event from the first to the last day of the section's classes,
+// skipping holidays, and each known exam is a single event.
+func writeCalendar(out io.Writer, sections []calendarSection, now time.Time) error {
+	loc, err := time.LoadLocation(calendarTZ)
+	if err != nil {
+		return fmt.Errorf("failed to load the calendar time zone => %s", err.Error())
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	w := &icsWriter{w: out}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//ADI//dataupdates//EN")
+	w.line("CALSCALE:GREGORIAN")
+	for _, l := range calendarTimezone {
+		w.line(l)
+	}
+
+	for _, s := range sections {
+		// UNTIL is in UTC, the end of the last day of classes
+		bounds := s.Bounds
+		end := time.Date(bounds.End.Year(), bounds.End.Month(), bounds.End.Day(), 23, 59, 59, 0, loc)
+		until := end.UTC().Format("20060102T150405Z")
+
+		for _, m := range s.Meetings {
+			days := m.Weekdays()
+			first, ok := firstMeeting(bounds.Start, days)
+			if !ok || m.StartTime == m.EndTime || first.After(bounds.End) {
+				continue // no scheduled time
+			}
+			var byDay []string
+			meetsOn := make(map[time.Weekday]bool)
+			for _, day := range days {
+				byDay = append(byDay, icalWeekdays[day])
+				meetsOn[day] = true
+			}
+
+			w.line("BEGIN:VEVENT")
+			w.line(fmt.Sprintf("UID:%s-%s-%d@dataupdates", s.Term, s.CallNumber, m.Slot))
+			w.line("DTSTAMP:" + stamp)
+			w.line("DTSTART;TZID=" + calendarTZ + ":" + icalLocalTime(first, m.StartTime))
+			w.line("DTEND;TZID=" + calendarTZ + ":" + icalLocalTime(first, m.EndTime))
+			w.line("RRULE:FREQ=WEEKLY;BYDAY=" + strings.Join(byDay, ",") + ";UNTIL=" + until)
+			for _, h := range bounds.Holidays {
+				if meetsOn[h.Weekday()] && !h.Before(first) {
+					w.line("EXDATE;TZID=" + calendarTZ + ":" + icalLocalTime(h, m.StartTime))
+				}
+			}
+			w.line("SUMMARY:" + icalText(s.summary()))
+			if loc := m.location(); loc != "" {
+				w.line("LOCATION:" + icalText(loc))
+			}
+			w.line("DESCRIPTION:" + icalText(fmt.Sprintf("Call number %s, %s", s.CallNumber, s.TypeName)))
+			w.line("END:VEVENT")
+		}
+
+		exam := parseExam(s.ExamMeet, s.ExamDate)
+		if exam == nil {
+			continue
+		}
+		w.line("BEGIN:VEVENT")
+		w.line(fmt.Sprintf("UID:%s-%s-exam@dataupdates", s.Term, s.CallNumber))
+		w.line("DTSTAMP:" + stamp)
+		if exam.Start == exam.End {
+			// the exam's time is not known, so it takes the whole day
+			w.line("DTSTART;VALUE=DATE:" + exam.Date.Format("20060102"))
+		} else {
+			w.line("DTSTART;TZID=" + calendarTZ + ":" + icalLocalTime(exam.Date, exam.Start.String()+":00"))
+			w.line("DTEND;TZID=" + calendarTZ + ":" + icalLocalTime(exam.Date, exam.End.String()+":00"))
+		}
+		w.line("SUMMARY:" + icalText(s.Course+" Final Exam"))
+		if s.ExamMeet != "" {
+			if loc := parseMeeting(0, s.ExamMeet).location(); loc != "" {
+				w.line("LOCATION:" + icalText(loc))
+			}
+		}
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+	return w.err
+}
+
+// loadCalendarSections() loads the term's sections with the given call numbers
+func loadCalendarSections(ctx context.Context, db *sql.DB, term string, callNumbers []string) ([]calendarSection, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+sectionColumns+`, coalesce(C.coursetitle, ''), coalesce(C.subtermcode, '')
+		 FROM sections_v2_t S JOIN courses_v2_t C
+		 ON C.course = S.course
+		 WHERE S.term = $1 AND S.callnumber = ANY($2::integer[]) AND S.cancelled_at IS NULL
+		 ORDER BY S.course, S.callnumber`,
+		term, "{"+strings.Join(callNumbers, ",")+"}",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying sections => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var sections []calendarSection
+	for rows.Next() {
+		var s calendarSection
+		if s.apiSection, err = scanSection(rows, &s.Title, &s.SubtermCode); err != nil {
+			return nil, fmt.Errorf("Error while processing sections => %s", err.Error())
+		}
+		sections = append(sections, s)
+	}
+	return sections, rows.Err()
+}
+
+// parseCallNumbers() checks each of a comma separated list of call numbers is
+// a number, EX: 13704,13705
+func parseCallNumbers(s string) ([]string, error) {
+	calls := splitList(s)
+	for _, call := range calls {
+		if _, err := strconv.Atoi(call); err != nil {
+			return nil, fmt.Errorf("calls must be numbers, found %q", call)
+		}
+	}
+	return calls, nil
+}
+
+// parseTermBounds() reads the first and last days of classes, EX: 2014-09-02
+func parseTermBounds(start, end string) (termBounds, error) {
+	var b termBounds
+	var err error
+	if b.Start, err = time.Parse("2006-01-02", start); err != nil {
+		return b, fmt.Errorf("start must be a date such as 2014-09-02")
+	}
+	if b.End, err = time.Parse("2006-01-02", end); err != nil {
+		return b, fmt.Errorf("end must be a date such as 2014-12-12")
+	}
+	if b.End.Before(b.Start) {
+		return b, fmt.Errorf("end must not be before start")
+	}
+	return b, nil
+}
+
+// setCalendarBounds() gives every section the 'start' and 'end' dates when
+// they are set, or else the dates of its term and subterm in the calendar
+func setCalendarBounds(sections []calendarSection, cal termCalendar, start, end string) error {
+	if start != "" || end != "" {
+		bounds, err := parseTermBounds(start, end)
+		if err != nil {
+			return err
+		}
+		for i := range sections {
+			sections[i].Bounds = bounds
+		}
+		return nil
+	}
+
+	for i, s := range sections {
+		bounds, err := cal.bounds(s.Term, s.SubtermCode)
+		if err != nil {
+			return err
+		}
+		sections[i].Bounds = bounds
+	}
+	return nil
+}
+
+// GET /calendar.ics?term=&calls=&start=&end=
+func (a *api) calendar(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	calls, err := parseCallNumbers(q.Get("calls"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Get("term") == "" || len(calls) == 0 {
+		http.Error(w, "term and calls must be set", http.StatusBadRequest)
+		return
+	}
+
+	sections, err := loadCalendarSections(r.Context(), a.db, q.Get("term"), calls)
+	if err != nil {
+		apiError(w, r, err)
+		return
+	}
+	if err := setCalendarBounds(sections, a.terms, q.Get("start"), q.Get("end")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := writeCalendar(&buf, sections, time.Now()); err != nil {
+		apiError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="schedule.ics"`)
+	w.Write(buf.Bytes())
+}
+
+// icalCmd() writes the sections' classes and exams as an .ics file
+func icalCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("ical", flag.ExitOnError)
+	term := flags.String("term", "", "Term of the sections, EX: 20143, defaults to the calendar's current term")
+	calls := flags.String("calls", "", "Comma separated call numbers to export")
+	start := flags.String("start", "", "First day of classes, EX: 2014-09-02")
+	end := flags.String("end", "", "Last day of classes, EX: 2014-12-12")
+	calendarFile := flags.String("calendar", "", "Term calendar to take dates and holidays from instead of -start and -end")
+	output := flags.String("out", "", "File to write, defaults to stdout")
+	flags.Parse(args)
+	callNumbers, err := parseCallNumbers(*calls)
+	if err != nil {
+		return fmt.Errorf("-%s", err.Error())
+	}
+	if len(callNumbers) == 0 {
+		return fmt.Errorf("-calls must be set")
+	}
+
+	var cal termCalendar
+	if *calendarFile != "" {
+		if cal, err = loadTermCalendar(*calendarFile); err != nil {
+			return err
+		}
+	} else if *start == "" || *end == "" {
+		return fmt.Errorf("-start and -end, or -calendar, must be set")
+	}
+	if *term == "" {
+		current, ok := cal.current(time.Now())
+		if !ok {
+			return fmt.Errorf("-term must be set, the term calendar has no current term")
+		}
+		*term = current
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	sections, err := loadCalendarSections(ctx, db, *term, callNumbers)
+	if err != nil {
+		return err
+	}
+	if err := setCalendarBounds(sections, cal, *start, *end); err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("Failed to create file, %s, with error: %s", *output, err.Error())
+		}
+		defer file.Close()
+		out = file
+	}
+	return writeCalendar(out, sections, time.Now())
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCalendar(t *testing.T) {
+	s := calendarSection{Title: "Operating Systems I"}
+	s.Course = "COMS4118"
+	s.Term = "20143"
+	s.CallNumber = "13704"
+	s.TypeName = "LECTURE"
+	s.Meets1 = meetsString("TR", "10:10A", "11:25A", "MATHEMATICS", "207")
+	s.ExamDate = "12/18/2014"
+	s.fillMeetings()
+
+	sections := []calendarSection{s}
+	if err := setCalendarBounds(sections, testTermCalendar, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeCalendar(&buf, sections, time.Date(2014, 8, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	ics := buf.String()
+
+	// the first Tuesday or Thursday from Wednesday the 3rd is Thursday the 4th
+	for _, line := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:20143-13704-1@dataupdates\r\n",
+		"DTSTART;TZID=America/New_York:20140904T101000\r\n",
+		"DTEND;TZID=America/New_York:20140904T112500\r\n",
+		"RRULE:FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20141213T045959Z\r\n",
+		"EXDATE;TZID=America/New_York:20141104T101000\r\n",
+		"EXDATE;TZID=America/New_York:20141127T101000\r\n",
+		"SUMMARY:COMS4118 Operating Systems I\r\n",
+		"LOCATION:MATHEMATICS 207\r\n",
+		"DESCRIPTION:Call number 13704\\, LECTURE\r\n",
+		"UID:20143-13704-exam@dataupdates\r\n",
+		"DTSTART;VALUE=DATE:20141218\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, line) {
+			t.Errorf("Expected calendar to contain %q, found:\n%s", line, ics)
+		}
+	}
+	if strings.Contains(ics, "20141103") {
+		t.Error("Expected no EXDATE for a holiday the section does not meet on")
+	}
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("Expected a class and an exam event, found %d events", n)
+	}
+}
+
+func TestICSLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	w := &icsWriter{w: &buf}
+	w.line("SUMMARY:" + strings.Repeat("é", 100))
+	for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("Expected lines of at most 75 octets, found %d", len(l))
+		}
+	}
+	unfolded := strings.Replace(buf.String(), "\r\n ", "", -1)
+	if unfolded != "SUMMARY:"+strings.Repeat("é", 100)+"\r\n" {
+		t.Errorf("Expected folding to be reversible, found %q", unfolded)
+	}
+}
+
+func TestParseTermBounds(t *testing.T) {
+	b, err := parseTermBounds("2014-09-03", "2014-12-12")
+	if err != nil || b.End.Sub(b.Start) != 100*24*time.Hour {
+		t.Errorf("Expected 100 days of classes, found %v %v", b, err)
+	}
+	if _, err := parseTermBounds("2014-12-12", "2014-09-02"); err == nil {
+		t.Error("Expected an end before the start to be rejected")
+	}
+	if _, err := parseTermBounds("09/02/2014", "2014-12-12"); err == nil {
+		t.Error("Expected an invalid date to be rejected")
+	}
+}
+
+func TestParseCallNumbers(t *testing.T) {
+	if calls, err := parseCallNumbers("13704, 13705"); err != nil || strings.Join(calls, ",") != "13704,13705" {
+		t.Errorf("Expected both call numbers, found %v %v", calls, err)
+	}
+	if _, err := parseCallNumbers("13704,abc"); err == nil {
+		t.Error("Expected a call number that is not a number to be rejected")
+	}
+
+	// the API answers 400 rather than passing it to Postgres
+	a, mock := newAPIMock(t)
+	if rec := serveAPI(a, "/calendar.ics?term=20143&calls=abc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a 400 for calls=abc, found %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
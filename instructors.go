@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kennygrant/sanitize"
+)
+
+var (
+	// matches the "Instructor(s)" row of a bulletin page
+	instructorsRow = regexp.MustCompile(`Instructors?</td>\s*<td bgcolor=#DADADA>(?s:(.*?))</td>`)
+	lineBreaks     = regexp.MustCompile(`(?i)<br\s*/?>`)
+	nameJunk       = regexp.MustCompile(`[^A-Z ,'-]+`) // anything but letters and the punctuation names keep
+)
+
+// parsePageInstructors() finds the full instructor names listed on a bulletin page
+func parsePageInstructors(page []byte) []string {
+	res := instructorsRow.FindSubmatch(page)
+	if len(res) != 2 {
+		return nil
+	}
+
+	var names []string
+	for _, line := range lineBreaks.Split(string(res[1]), -1) {
+		name := strings.TrimSpace(tags.ReplaceAllString(line, ""))
+		if name != "" {
+			names = append(names, sanitize.Accents(name))
+		}
+	}
+	return names
+}
+
+// personName is a normalized instructor name
+type personName struct {
+	Last  string
+	Given []string // first name, then any middle names or initials
+}
+
+// parseName() normalizes both the feed's "VITUCCI, JOHN N" and the bulletin's
+// "John N Vitucci" forms of a name
+func parseName(s string) personName {
+	s = strings.ToUpper(sanitize.Accents(s))
+	s = nameJunk.ReplaceAllString(strings.Replace(s, ".", " ", -1), "")
+
+	var n personName
+	if i := strings.Index(s, ","); i >= 0 { // LAST, GIVEN
+		n.Last = strings.Join(strings.Fields(s[:i]), " ")
+		n.Given = strings.Fields(strings.Replace(s[i+1:], ",", " ", -1))
+	} else if fields := strings.Fields(s); len(fields) > 0 { // GIVEN LAST
+		n.Last = fields[len(fields)-1]
+		n.Given = fields[:len(fields)-1]
+	}
+	return n
+}
+
+// Canonical is the key an instructor is stored under, EX: "VITUCCI, JOHN N"
+func (n personName) Canonical() string {
+	if len(n.Given) == 0 {
+		return n.Last
+	}
+	return n.Last + ", " + strings.Join(n.Given, " ")
+}
+
+// Display is the name as it should be shown, EX: "John N Vitucci"
+func (n personName) Display() string {
+	words := append(append([]string{}, n.Given...), strings.Fields(n.Last)...)
+	for i, w := range words {
+		words[i] = w[:1] + strings.ToLower(w[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+// whether 'a' and 'b' are equal or one is a truncation of the other
+func prefixMatch(a, b string, minLen int) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == b || (len(a) >= minLen && strings.HasPrefix(b, a))
+}
+
+// namesMatch() decides whether two names are likely the same person. The feed
+// truncates names and the bulletin spells them out, so last names may be
+// truncated, first names may be initials and middle names only have to agree
+// when both names have one.
+func namesMatch(a, b personName) bool {
+	if a.Last == "" || b.Last == "" || len(a.Given) == 0 || len(b.Given) == 0 {
+		return a.Canonical() == b.Canonical()
+	}
+	if !prefixMatch(a.Last, b.Last, 3) || !prefixMatch(a.Given[0], b.Given[0], 1) {
+		return false
+	}
+	if len(a.Given) > 1 && len(b.Given) > 1 && a.Given[1][0] != b.Given[1][0] {
+		return false
+	}
+	return true
+}
+
+// instructorNames() pairs each instructor in the feed with the matching, and
+// more complete, name from the bulletin page if one was found
+func (c Course) instructorNames() []personName {
+	var bulletin []personName
+	for _, name := range c.BulletinInstructors {
+		bulletin = append(bulletin, parseName(name))
+	}
+
+	var names []personName
+	for _, raw := range []string{c.Instructor1Name, c.Instructor2Name, c.Instructor3Name, c.Instructor4Name} {
+		n := parseName(raw)
+		if n.Last == "" {
+			continue
+		}
+		for _, b := range bulletin {
+			if namesMatch(n, b) {
+				n = b
+				break
+			}
+		}
+		names = append(names, n)
+	}
+	return names
+}
+
+// instructorStore resolves names to instructors_t IDs, creating instructors
+// that have not been seen before
+type instructorStore struct {
+	db         *sql.DB
+	candidates string           // the query for instructors who may share a last name
+	cache      map[string]int64 // canonical name --> ID
+}
+
+func newInstructorStore(db *sql.DB, candidates string) *instructorStore {
+	return &instructorStore{db: db, candidates: candidates, cache: make(map[string]int64)}
+}
+
+// the instructors who may share a last name, matched on its first three
+// letters to allow for names truncated by the feed. The Postgres query uses
+// the expression of 'instructors_t_lastname_idx', and the SQLite query that
+// of its index in the catalog.
+var (
+	instructorCandidatesQuery = `
+SELECT id, canonical
+ FROM instructors_t
+ WHERE left(lastname, 3) = left($1, 3);
+`
+	sqliteInstructorCandidatesQuery = `
+SELECT id, canonical
+ FROM instructors_t
+ WHERE substr(lastname, 1, 3) = substr($1, 1, 3);
+`
+)
+
+// resolve() finds the ID of the instructor matching 'n', keeping the most
+// complete version of their name
+func (s *instructorStore) resolve(ctx context.Context, n personName) (int64, error) {
+	if id, ok := s.cache[n.Canonical()]; ok {
+		return id, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.candidates, n.Last)
+	if err != nil {
+		return 0, fmt.Errorf("Error while querying instructors => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var id int64
+	var match personName
+	for rows.Next() {
+		var candidateID int64
+		var canonical string
+		if err := rows.Scan(&candidateID, &canonical); err != nil {
+			return 0, fmt.Errorf("Error while processing instructors => %s", err.Error())
+		}
+		if candidate := parseName(canonical); namesMatch(n, candidate) {
+			id, match = candidateID, candidate
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("Error while reading instructors => %s", err.Error())
+	}
+	rows.Close()
+
+	if id == 0 {
+		err = s.db.QueryRowContext(ctx,
+			`INSERT INTO instructors_t (name, canonical, lastname) VALUES ($1, $2, $3) RETURNING id`,
+			n.Display(), n.Canonical(), n.Last,
+		).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to insert instructors_t, %s => %s", n.Canonical(), err.Error())
+		}
+	} else if len(n.Canonical()) > len(match.Canonical()) { // we found a fuller name
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE instructors_t SET name = $2, canonical = $3, lastname = $4 WHERE id = $1`,
+			id, n.Display(), n.Canonical(), n.Last,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to update instructors_t, %s => %s", n.Canonical(), err.Error())
+		}
+	}
+
+	s.cache[n.Canonical()] = id
+	return id, nil
+}
+
+// InsertSectionInstructors replaces the section's rows in the
+// 'section_instructors_t' database with its current instructors
+func (c Course) InsertSectionInstructors(ctx context.Context, db *sql.DB, store *instructorStore) error {
+	var ids []int64
+	for _, n := range c.instructorNames() {
+		id, err := store.resolve(ctx, n)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM section_instructors_t WHERE term = $1 AND callnumber = $2`, c.Term, c.CallNumber)
+	if err != nil {
+		return fmt.Errorf("Failed to clear section_instructors_t, %s %s => %s", c.Term, c.CallNumber, err.Error())
+	}
+	for i, id := range ids {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO section_instructors_t (term, callnumber, instructor_id, position) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+			c.Term, c.CallNumber, id, i+1,
+		)
+		if err != nil {
+			return fmt.Errorf("Failed to insert section_instructors_t, %s %s => %s", c.Term, c.CallNumber, err.Error())
+		}
+	}
+	return tx.Commit()
+}
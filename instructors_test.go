@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+var canonicalNames = map[string]string{
+	"VITUCCI, JOHN N":   "VITUCCI, JOHN N",
+	"John N Vitucci":    "VITUCCI, JOHN N",
+	"john n. vitucci":   "VITUCCI, JOHN N",
+	"  MINETTI,LISA  ":  "MINETTI, LISA",
+	"José Martínez":     "MARTINEZ, JOSE",
+	"O'NEIL, MARY-KATE": "O'NEIL, MARY-KATE",
+	"":                  "",
+}
+
+func TestParseName(t *testing.T) {
+	for raw, canonical := range canonicalNames {
+		if c := parseName(raw).Canonical(); c != canonical {
+			t.Errorf("Expected %q to normalize to %q, found %q", raw, canonical, c)
+		}
+	}
+	if d := parseName("VITUCCI, JOHN N").Display(); d != "John N Vitucci" {
+		t.Errorf("Expected a display name of John N Vitucci, found %s", d)
+	}
+}
+
+var nameMatches = []struct {
+	a, b  string
+	match bool
+}{
+	{"VITUCCI, JOHN N", "John N Vitucci", true},
+	{"VITUCCI, JOHN", "John N Vitucci", true},    // missing middle initial
+	{"VITUCCI, J", "John Vitucci", true},         // initial only
+	{"VITUCC, JOHN", "John Vitucci", true},       // truncated by the feed
+	{"VITUCCI, JOHN N", "John Q Vitucci", false}, // middle initials disagree
+	{"VITUCCI, JOHN", "Lisa Vitucci", false},
+	{"MINETTI, LISA", "John Vitucci", false},
+}
+
+func TestNamesMatch(t *testing.T) {
+	for _, m := range nameMatches {
+		if namesMatch(parseName(m.a), parseName(m.b)) != m.match {
+			t.Errorf("Expected match(%q, %q) to be %t", m.a, m.b, m.match)
+		}
+	}
+}
+
+func TestInstructorNames(t *testing.T) {
+	c := Course{
+		Section: Section{
+			Instructor1Name: "VITUCCI, JOHN",
+			Instructor2Name: "MINETTI, LISA",
+		},
+		BulletinInstructors: []string{"Lisa Minetti", "John N Vitucci"},
+	}
+	names := c.instructorNames()
+	if len(names) != 2 {
+		t.Fatalf("Expected 2 instructors, found %d", len(names))
+	}
+	if d := names[0].Display(); d != "John N Vitucci" {
+		t.Errorf("Expected the bulletin's full name, found %s", d)
+	}
+	if d := names[1].Display(); d != "Lisa Minetti" {
+		t.Errorf("Expected Lisa Minetti, found %s", d)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// batchFunc fetches the values of many keys at once. Keys without a value
+// are left out of the map.
+type batchFunc func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// batchLoader is a DataLoader-style cache that fetches keys in batches. A
+// resolver returning a list queues the keys its items will need, so the first
+// item to load() fetches the whole list's values in a single query rather
+// than one query per item.
+//
+// A batchLoader lives for a single request.
+type batchLoader struct {
+	fetch batchFunc
+
+	mu      sync.Mutex
+	queued  []string
+	values  map[string]interface{}
+	fetched map[string]bool
+	batches int // number of fetches, for tests
+}
+
+func newBatchLoader(fetch batchFunc) *batchLoader {
+	return &batchLoader{
+		fetch:   fetch,
+		values:  make(map[string]interface{}),
+		fetched: make(map[string]bool),
+	}
+}
+
+// queue() adds keys to be fetched along with the next load()
+func (l *batchLoader) queue(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if !l.fetched[key] {
+			l.queued = append(l.queued, key)
+		}
+	}
+}
+
+// prime() caches a value that was read by another query
+func (l *batchLoader) prime(key string, v interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.values[key] = v
+	l.fetched[key] = true
+}
+
+// load() returns the key's value, or nil if it has none. Loads waiting on
+// another's fetch find their value cached once it finishes.
+func (l *batchLoader) load(ctx context.Context, key string) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fetched[key] {
+		return l.values[key], nil
+	}
+
+	keys := []string{key}
+	seen := map[string]bool{key: true}
+	for _, k := range l.queued {
+		if !l.fetched[k] && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	values, err := l.fetch(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	l.batches++
+	l.queued = nil
+	for _, k := range keys {
+		l.values[k] = values[k]
+		l.fetched[k] = true
+	}
+	return l.values[key], nil
+}
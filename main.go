@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/lib/pq" // register the postgres driver w/ sql
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -16,6 +21,22 @@ const (
 	MaxHTTPRequests = 10
 )
 
+// commands are run in place of the load when named as the first argument
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"attributes":          attributesCmd,
+	"conflicts":           conflictsCmd,
+	"enrollment":          enrollmentCmd,
+	"export":              exportCmd,
+	"housing":             housingCmd,
+	"history":             historyCmd,
+	"ical":                icalCmd,
+	"migrate-course-keys": migrateCourseKeysCmd,
+	"rooms":               roomsCmd,
+	"serve":               serveCmd,
+	"snapshot":            snapshotCmd,
+	"tokens":              tokensCmd,
+}
+
 func getEnvVar(name string) string {
 	val := os.Getenv(name)
 	if val == "" {
@@ -39,46 +60,188 @@ func connectPG() *sql.DB {
 	return db
 }
 
+// loadOptions configures a run of the course pipeline
+type loadOptions struct {
+	SnapshotEnrollment bool      // append each section's enrollment to enrollment_snapshots_t
+	StartedAt          time.Time // when the run started, shared by all of its snapshots
+	WebhookURL         string    // where to post change events, if set
+	SkipReconcile      bool      // leave sections missing from the load untouched
+	MaxRemoved         float64   // largest fraction of a term's sections reconciliation may cancel
+	Stats              *runStats // counts and stage durations, may be nil
+}
+
+// loadCourses() runs the course pipeline over 'filename':
+// parse --> scrape descriptions --> detect changes --> insert to the database,
+// then extracts prerequisites and cross-listings from the descriptions and
+// cancels the sections of each loaded term that were not in the file.
+// Each stage closes its output channel when it returns so the next stage can
+// drain and exit, and the first error cancels every other stage. The sections
+// found are returned even when the load fails.
+func loadCourses(ctx context.Context, db *sql.DB, filename string, opts loadOptions) (sectionSet, error) {
+	seen := make(sectionSet)
+	file, err := os.Open(filename)
+	if err != nil {
+		return seen, fmt.Errorf("Failed to open file, %s, with error: %s", filename, err.Error())
+	}
+	defer file.Close()
+
+	g, gctx := errgroup.WithContext(ctx)
+	instructors := newInstructorStore(db, instructorCandidatesQuery)
+	courseChan := make(chan Course)
+	describedChan := make(chan Course, 50)
+	dbQueue := make(chan Course, 50)
+
+	stats := opts.Stats
+	store := newPGCourseStore(db)
+	g.Go(func() error {
+		return stats.stage("parse", func() error { return parseCourses(gctx, file, courseChan, stats) })
+	})
+	g.Go(func() error {
+		return stats.stage("scrape", func() error { return scrapeDescriptions(gctx, courseChan, describedChan, stats) })
+	})
+	g.Go(func() error {
+		return stats.stage("detect_changes", func() error { return detectChanges(gctx, db, describedChan, dbQueue, stats) })
+	})
+	g.Go(func() error {
+		return stats.stage("insert", func() error { return dbWorker(gctx, db, store, instructors, dbQueue, opts, seen) })
+	})
+	if err := g.Wait(); err != nil {
+		return seen, err
+	}
+	if err := stats.stage("requisites", func() error { return updateRequisites(ctx, db) }); err != nil {
+		return seen, err
+	}
+
+	if opts.SkipReconcile {
+		return seen, nil
+	}
+	return seen, stats.stage("reconcile", func() error { return reconcileSections(ctx, db, seen, opts.MaxRemoved) })
+}
+
+// run() loads 'filename', recording the run in 'load_runs'. The load is
+// skipped when the file is the same as the last successful load's that ran
+// the same stages, unless 'force' is set.
+func run(ctx context.Context, db *sql.DB, filename string, skipPG, skipES, force bool, opts loadOptions) error {
+	lr := &loadRun{StartedAt: opts.StartedAt, Status: runRunning}
+	if !skipPG {
+		checksum, err := fileChecksum(filename)
+		if err != nil {
+			return err
+		}
+		lr.Filename, lr.Checksum = filename, checksum
+
+		last, err := lastSuccessfulChecksum(ctx, db, !skipES)
+		if err != nil {
+			return err
+		}
+		if checksum == last && !force {
+			slog.Info("skipping load, the file is unchanged since the last successful load", "file", filename, "checksum", checksum)
+			lr.Status = runSkipped
+			if err := lr.start(ctx, db); err != nil {
+				return err
+			}
+			return lr.finish(ctx, db, time.Now(), nil)
+		}
+	}
+	if !skipES {
+		lr.ESIndex = esIndex
+	}
+	if err := lr.start(ctx, db); err != nil {
+		return err
+	}
+
+	err := load(ctx, db, filename, skipPG, skipES, opts, lr)
+	// record the end of the run even when the load was interrupted
+	if ferr := lr.finish(context.WithoutCancel(ctx), db, time.Now(), err); ferr != nil {
+		slog.Error("failed to record load run", "run", lr.ID, "err", ferr.Error())
+	}
+	return err
+}
+
+// load() runs each enabled stage of a load, noting the terms covered in 'lr'
+func load(ctx context.Context, db *sql.DB, filename string, skipPG, skipES bool, opts loadOptions, lr *loadRun) error {
+	if !skipPG { // optionally skip postgres updates
+		seen, err := loadCourses(ctx, db, filename, opts)
+		lr.Terms = seen.terms()
+		if err != nil {
+			return fmt.Errorf("failed to load courses => %s", err.Error())
+		}
+	}
+
+	if opts.WebhookURL != "" { // optionally notify the webhook of changes
+		err := opts.Stats.stage("webhook", func() error { return deliverEvents(ctx, db, opts.WebhookURL) })
+		if err != nil {
+			return fmt.Errorf("failed to deliver change events => %s", err.Error())
+		}
+	}
+
+	if !skipES { // optionally skip elastic search updates
+		if err := opts.Stats.stage("es", func() error { return updateES(ctx, db, opts.Stats) }); err != nil {
+			return fmt.Errorf("failed to update ES => %s", err.Error())
+		}
+	}
+	return nil
+}
+
 func main() {
 	filename := flag.String("file", "./doc.json", "JSON file to be read in for processing")
 	skipPG := flag.Bool("skip-pg", false, "Skip running the PG database updates")
 	skipES := flag.Bool("skip-es", false, "Skip running the ES index updates")
+	snapshot := flag.Bool("snapshot-enrollment", false, "Record each section's enrollment in the snapshot time series")
+	webhook := flag.String("webhook", "", "URL to post section change events to")
+	skipReconcile := flag.Bool("skip-reconcile", false, "Skip cancelling sections that are missing from the file")
+	maxRemoved := flag.Float64("max-removed", 0.1, "Abort reconciliation if more than this fraction of a term's sections would be cancelled")
+	logFormat := flag.String("log-format", "json", "Log as 'json' or 'text' lines")
+	metricsFile := flag.String("metrics-file", "", "Write the load's metrics to this file in the Prometheus text format")
+	force := flag.Bool("force", false, "Load the file even if it is unchanged since the last successful load")
+	sqliteFile := flag.String("sqlite", "", "Write the catalog to this SQLite file in place of loading Postgres and ES")
+	flag.StringVar(&bulletinURL, "bulletin-url", bulletinURL, "Root of the bulletin pages descriptions are scraped from")
 	flag.Parse()
 
-	// open database connection
-	db := connectPG()
-	defer db.Close()
-
-	if !*skipPG { // optionally skip postgres updates
-		jsonFile := *filename
-		var wg sync.WaitGroup
-
-		// parse the json file of Courses
-		courseChan := make(chan Course)
-		go parseCourses(jsonFile, courseChan, &wg)
-
-		// db worker reads from dbQueue and inserts to the database
-		wg.Add(1)
-		dbQueue := make(chan Course, 50)
-		descCache := make(map[string]string) //  CourseFull --> description
-		go dbWorker(db, dbQueue, &wg, descCache)
-
-		// process courses as they come from the parser
-		var c Course
-		var more bool
-		for {
-			// reads in a course that is ready for insertion
-			c, more = <-courseChan
-			// sends course to be inserted to the database
-			dbQueue <- c
-			if !more {
-				break
+	if err := setupLogging(os.Stderr, *logFormat); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// cancel every stage on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if flag.NArg() > 0 { // run a subcommand in place of the load
+		cmd, ok := commands[flag.Arg(0)]
+		if !ok {
+			log.Fatalf("unknown command, %s", flag.Arg(0))
+		}
+		err = cmd(ctx, flag.Args()[1:])
+	} else {
+		started := time.Now()
+		stats := newRunStats(started)
+		opts := loadOptions{
+			SnapshotEnrollment: *snapshot,
+			StartedAt:          started,
+			WebhookURL:         *webhook,
+			SkipReconcile:      *skipReconcile,
+			MaxRemoved:         *maxRemoved,
+			Stats:              stats,
+		}
+
+		if *sqliteFile != "" { // an offline catalog needs neither PG nor ES
+			err = writeSQLiteCatalog(ctx, *filename, *sqliteFile, opts)
+		} else {
+			db := connectPG()
+			defer db.Close()
+			err = run(ctx, db, *filename, *skipPG, *skipES, *force, opts)
+		}
+
+		finished := time.Now()
+		stats.logSummary(finished, err)
+		if *metricsFile != "" {
+			if merr := stats.writeMetricsFile(*metricsFile, finished, err); merr != nil {
+				slog.Error("failed to write metrics", "file", *metricsFile, "err", merr.Error())
 			}
 		}
-		wg.Wait()
 	}
-
-	if !*skipES { // optionally skip elastic search updates
-		updateES(db)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
 }
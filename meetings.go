@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the day letters used by MeetsOn, EX: "TR" => Tuesday, Thursday
+var weekdayLetters = map[rune]time.Weekday{
+	'U': time.Sunday,
+	'M': time.Monday,
+	'T': time.Tuesday,
+	'W': time.Wednesday,
+	'R': time.Thursday,
+	'F': time.Friday,
+	'S': time.Saturday,
+}
+
+// Meeting is one of a section's up to six meeting slots, Meets1-6
+type Meeting struct {
+	Slot      int    // which MeetsN the meeting came from
+	MeetsOn   string // EX: TR
+	StartTime string // EX: 10:10:00
+	EndTime   string
+	Building  string
+	Room      string
+}
+
+// parseMeeting() splits a raw MeetsN string into its pieces
+func parseMeeting(slot int, s string) Meeting {
+	return Meeting{
+		Slot:      slot,
+		MeetsOn:   meetsOn.parse(s),
+		StartTime: parseDate(startTime.parse(s)),
+		EndTime:   parseDate(endTime.parse(s)),
+		Building:  building.parse(s),
+		Room:      room.parse(s),
+	}
+}
+
+// Weekdays lists the days of the week the meeting is held on
+func (m Meeting) Weekdays() []time.Weekday {
+	var days []time.Weekday
+	for _, letter := range strings.ToUpper(m.MeetsOn) {
+		if day, ok := weekdayLetters[letter]; ok {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// weekdayLetter is the inverse of weekdayLetters
+func weekdayLetter(day time.Weekday) string {
+	for letter, d := range weekdayLetters {
+		if d == day {
+			return string(letter)
+		}
+	}
+	return ""
+}
+
+// fillMeetings() parses every non-empty MeetsN of the section. The first two
+// meetings are also kept in their own fields.
+func (s *Section) fillMeetings() {
+	s.StartTime1, s.EndTime1 = "00:00:00", "00:00:00"
+	s.StartTime2, s.EndTime2 = "00:00:00", "00:00:00"
+
+	s.Meetings = nil
+	for i, raw := range []string{s.Meets1, s.Meets2, s.Meets3, s.Meets4, s.Meets5, s.Meets6} {
+		if raw == "" {
+			continue
+		}
+		m := parseMeeting(i+1, raw)
+		s.Meetings = append(s.Meetings, m)
+
+		switch m.Slot {
+		case 1:
+			s.MeetsOn1, s.StartTime1, s.EndTime1, s.Building1, s.Room1 = m.MeetsOn, m.StartTime, m.EndTime, m.Building, m.Room
+		case 2:
+			s.MeetsOn2, s.StartTime2, s.EndTime2, s.Building2, s.Room2 = m.MeetsOn, m.StartTime, m.EndTime, m.Building, m.Room
+		}
+	}
+}
+
+// InsertSectionMeetings replaces the section's rows in the 'section_meetings_t'
+// database with a row per weekday of each of its meetings
+func (c Course) InsertSectionMeetings(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM section_meetings_t WHERE term = $1 AND callnumber = $2`, c.Term, c.CallNumber)
+	if err != nil {
+		return fmt.Errorf("Failed to clear section_meetings_t, %s %s => %s", c.Term, c.CallNumber, err.Error())
+	}
+
+	query := `INSERT INTO section_meetings_t (
+	term,
+	callnumber,
+	slot,
+	weekday,
+	starttime,
+	endtime,
+	building,
+	room
+	) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8
+	) ON CONFLICT DO NOTHING`
+	for _, m := range c.Meetings {
+		for _, day := range m.Weekdays() {
+			_, err := tx.ExecContext(
+				ctx,
+				query,
+				c.Term,
+				c.CallNumber,
+				m.Slot,
+				weekdayLetter(day),
+				m.StartTime,
+				m.EndTime,
+				m.Building,
+				m.Room,
+			)
+			if err != nil {
+				return fmt.Errorf("Failed to insert section_meetings_t, %s %s => %s", c.Term, c.CallNumber, err.Error())
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// lays a meeting out in the fixed width MeetsN format
+func meetsString(days, start, end, building, room string) string {
+	return fmt.Sprintf("%-7s%s-%s    %-11s%s", days, start, end, building, room)
+}
+
+func TestFillMeetings(t *testing.T) {
+	c := Course{
+		Course: "ACTUK4850K001",
+		Section: Section{
+			Meets1: meetsString("TR", "10:10A", "11:25A", "MATHEMATICS", "207"),
+			Meets3: meetsString("F", "08:10P", "10:00P", "HAMILTON", "503"),
+		},
+	}
+	if err := c.fill(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Meeting{
+		{Slot: 1, MeetsOn: "TR", StartTime: "10:10:00", EndTime: "11:25:00", Building: "MATHEMATICS", Room: "207"},
+		{Slot: 3, MeetsOn: "F", StartTime: "20:10:00", EndTime: "22:00:00", Building: "HAMILTON", Room: "503"},
+	}
+	if !reflect.DeepEqual(c.Meetings, expected) {
+		t.Errorf("Expected meetings %#v, found %#v", expected, c.Meetings)
+	}
+	if c.MeetsOn1 != "TR" || c.Room1 != "207" || c.StartTime2 != "00:00:00" {
+		t.Errorf("Expected the first meeting in the Meets1 fields, found %#v", c.Section)
+	}
+
+	days := c.Meetings[0].Weekdays()
+	if !reflect.DeepEqual(days, []time.Weekday{time.Tuesday, time.Thursday}) {
+		t.Errorf("Expected Tuesday and Thursday, found %v", days)
+	}
+	if l := weekdayLetter(time.Thursday); l != "R" {
+		t.Errorf("Expected Thursday to be R, found %s", l)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// roomKey identifies a room
+type roomKey struct {
+	Building string
+	Room     string
+}
+
+// booking is a weekly slot a room is taken by a section
+type booking struct {
+	Weekday    string // EX: R
+	StartTime  string // EX: 10:10:00
+	EndTime    string
+	CallNumber string
+	Course     string
+}
+
+// whether the booking overlaps [from, to) on 'weekday'
+func (b booking) overlaps(weekday, from, to string) bool {
+	return b.Weekday == weekday && b.StartTime < to && from < b.EndTime
+}
+
+// roomCalendar is the weekly occupancy of each room in a term
+type roomCalendar map[roomKey][]booking
+
+// roomSchedule is a room's calendar entry, used when exporting
+type roomSchedule struct {
+	Building string
+	Room     string
+	Bookings []booking
+}
+
+var roomCalendarQuery = `
+SELECT
+	M.building,
+	M.room,
+	M.weekday,
+	M.starttime::text,
+	M.endtime::text,
+	M.callnumber,
+	S.course
+ FROM section_meetings_t M JOIN sections_v2_t S
+ ON S.term = M.term AND S.callnumber = M.callnumber
+ WHERE M.term = $1
+	AND S.cancelled_at IS NULL
+	AND M.building <> '' AND M.room <> ''
+	AND ($2 = '' OR M.building = $2)
+ ORDER BY M.building, M.room, M.weekday, M.starttime;
+`
+
+// loadRoomCalendar() builds the occupancy of every room used in the term,
+// optionally limited to a single building
+func loadRoomCalendar(ctx context.Context, db *sql.DB, term, building string) (roomCalendar, error) {
+	rows, err := db.QueryContext(ctx, roomCalendarQuery, term, building)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying room meetings => %s", err.Error())
+	}
+	defer rows.Close()
+
+	cal := make(roomCalendar)
+	for rows.Next() {
+		var key roomKey
+		var b booking
+		if err := rows.Scan(&key.Building, &key.Room, &b.Weekday, &b.StartTime, &b.EndTime, &b.CallNumber, &b.Course); err != nil {
+			return nil, fmt.Errorf("Error while processing room meetings => %s", err.Error())
+		}
+		cal[key] = append(cal[key], b)
+	}
+	return cal, rows.Err()
+}
+
+// freeRooms() lists the rooms of 'building' that have no booking overlapping
+// [from, to) on 'weekday'. Only rooms that appear in the calendar are known.
+func (cal roomCalendar) freeRooms(building, weekday, from, to string) []roomKey {
+	var free []roomKey
+	for key, bookings := range cal {
+		if key.Building != building {
+			continue
+		}
+		taken := false
+		for _, b := range bookings {
+			if b.overlaps(weekday, from, to) {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			free = append(free, key)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool { return free[i].Room < free[j].Room })
+	return free
+}
+
+// schedules() flattens the calendar into a sorted list for export
+func (cal roomCalendar) schedules() []roomSchedule {
+	var list []roomSchedule
+	for key, bookings := range cal {
+		list = append(list, roomSchedule{Building: key.Building, Room: key.Room, Bookings: bookings})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Building != list[j].Building {
+			return list[i].Building < list[j].Building
+		}
+		return list[i].Room < list[j].Room
+	})
+	return list
+}
+
+// save() replaces the term's rows in the 'room_occupancy_t' database. A
+// calendar loaded for a single building only replaces that building's rows.
+func (cal roomCalendar) save(ctx context.Context, db *sql.DB, term, building string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM room_occupancy_t WHERE term = $1 AND ($2 = '' OR building = $2)`, term, building)
+	if err != nil {
+		return fmt.Errorf("Failed to clear room_occupancy_t, %s => %s", term, err.Error())
+	}
+
+	query := `INSERT INTO room_occupancy_t (
+	term,
+	building,
+	room,
+	weekday,
+	starttime,
+	endtime,
+	callnumber,
+	course
+	) VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8
+	)`
+	for key, bookings := range cal {
+		for _, b := range bookings {
+			_, err := tx.ExecContext(ctx, query, term, key.Building, key.Room, b.Weekday, b.StartTime, b.EndTime, b.CallNumber, b.Course)
+			if err != nil {
+				return fmt.Errorf("Failed to insert room_occupancy_t, %s %s => %s", key.Building, key.Room, err.Error())
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// parseClock() normalizes "14:00" or "2:00PM" to "14:00:00"
+func parseClock(s string) (string, error) {
+	for _, layout := range []string{"15:04", "15:04:05", "3:04PM", "3PM"} {
+		if t, err := time.Parse(layout, strings.ToUpper(s)); err == nil {
+			return t.Format("15:04:05"), nil
+		}
+	}
+	return "", fmt.Errorf("could not parse time, %s", s)
+}
+
+// roomsCmd() answers which rooms of a building are free, or exports the
+// term's room occupancy as JSON and to the room_occupancy_t table
+func roomsCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rooms", flag.ExitOnError)
+	term := flags.String("term", "", "Term to build the occupancy of, EX: 20143")
+	building := flags.String("building", "", "Only consider rooms in this building")
+	day := flags.String("day", "", "Day to find free rooms on, as a MeetsOn letter, EX: T")
+	from := flags.String("from", "", "Start of the window a room must be free for, EX: 14:00")
+	to := flags.String("to", "", "End of the window a room must be free for, EX: 16:00")
+	asJSON := flags.Bool("json", false, "Print the occupancy calendar as JSON")
+	save := flags.Bool("save", false, "Save the occupancy calendar to room_occupancy_t")
+	flags.Parse(args)
+	if *term == "" {
+		return fmt.Errorf("-term must be set")
+	}
+	if *asJSON && *day != "" {
+		return fmt.Errorf("-json and -day cannot be used together")
+	}
+
+	db := connectPG()
+	defer db.Close()
+
+	cal, err := loadRoomCalendar(ctx, db, *term, strings.ToUpper(*building))
+	if err != nil {
+		return err
+	}
+
+	if *save {
+		if err := cal.save(ctx, db, *term, strings.ToUpper(*building)); err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(cal.schedules())
+	}
+	if *day == "" {
+		return nil
+	}
+
+	if *building == "" {
+		return fmt.Errorf("-building must be set to find free rooms")
+	}
+	start, err := parseClock(*from)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(*to)
+	if err != nil {
+		return err
+	}
+	for _, key := range cal.freeRooms(strings.ToUpper(*building), strings.ToUpper(*day), start, end) {
+		fmt.Printf("%s %s\n", key.Building, key.Room)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testCalendar = roomCalendar{
+	{"MATHEMATICS", "207"}: {
+		{Weekday: "T", StartTime: "13:10:00", EndTime: "14:25:00", CallNumber: "1", Course: "MATH1101"},
+		{Weekday: "R", StartTime: "13:10:00", EndTime: "14:25:00", CallNumber: "1", Course: "MATH1101"},
+	},
+	{"MATHEMATICS", "312"}: {
+		{Weekday: "T", StartTime: "15:30:00", EndTime: "16:45:00", CallNumber: "2", Course: "MATH2010"},
+	},
+	{"MATHEMATICS", "417"}: {
+		{Weekday: "M", StartTime: "14:10:00", EndTime: "15:25:00", CallNumber: "3", Course: "MATH3007"},
+	},
+	{"HAMILTON", "503"}: {},
+}
+
+func TestFreeRooms(t *testing.T) {
+	free := testCalendar.freeRooms("MATHEMATICS", "T", "14:25:00", "15:30:00")
+	expected := []roomKey{{"MATHEMATICS", "207"}, {"MATHEMATICS", "312"}, {"MATHEMATICS", "417"}}
+	if !reflect.DeepEqual(free, expected) {
+		t.Errorf("Expected bookings that only touch the window to leave rooms free, found %v", free)
+	}
+
+	free = testCalendar.freeRooms("MATHEMATICS", "T", "14:00:00", "16:00:00")
+	if !reflect.DeepEqual(free, []roomKey{{"MATHEMATICS", "417"}}) {
+		t.Errorf("Expected only 417 to be free Tuesday 2-4pm, found %v", free)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	for in, expected := range map[string]string{"14:00": "14:00:00", "2:00pm": "14:00:00", "9AM": "09:00:00"} {
+		if out, err := parseClock(in); err != nil || out != expected {
+			t.Errorf("Expected %s to parse to %s, found %s, %v", in, expected, out, err)
+		}
+	}
+	if _, err := parseClock("noon"); err == nil {
+		t.Error("Expected an error for an unparseable time")
+	}
+}
+
+func TestSaveRoomCalendar(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a single building's calendar only replaces that building's rows
+	cal := roomCalendar{{"HAMILTON", "503"}: {{Weekday: "M", StartTime: "10:10:00", EndTime: "11:25:00", CallNumber: "4", Course: "ENGL1010"}}}
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM room_occupancy_t WHERE term = \$1 AND \(\$2 = '' OR building = \$2\)`).
+		WithArgs("20143", "HAMILTON").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`INSERT INTO room_occupancy_t`).
+		WithArgs("20143", "HAMILTON", "503", "M", "10:10:00", "11:25:00", "4", "ENGL1010").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := cal.save(context.Background(), db, "20143", "HAMILTON"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A minimal Parquet writer for the export: every column is optional, and a
+// file is a single row group of PLAIN encoded, uncompressed pages, one per
+// column. See https://github.com/apache/parquet-format for the layout.
+
+const parquetMagic = "PAR1"
+
+// parquet-format enum values used by the writer
+const (
+	parquetInt64     = 2 // Type
+	parquetByteArray = 6
+	parquetOptional  = 1 // FieldRepetitionType
+	parquetUTF8      = 0 // ConvertedType
+	parquetPlain     = 0 // Encoding
+	parquetRLE       = 3
+	parquetDataPage  = 0 // PageType
+)
+
+// thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the thrift compact protocol, which
+// Parquet uses for its page headers and footer
+type thriftWriter struct {
+	bytes.Buffer
+	lastIDs []int16 // last field id of each open struct
+}
+
+func (w *thriftWriter) uvarint(n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.Write(b[:binary.PutUvarint(b[:], n)])
+}
+
+func (w *thriftWriter) varint(n int64) {
+	w.uvarint(uint64((n << 1) ^ (n >> 63))) // zigzag
+}
+
+// begin() opens a struct, as a field or a list element
+func (w *thriftWriter) begin() {
+	w.lastIDs = append(w.lastIDs, 0)
+}
+
+// end() closes the open struct
+func (w *thriftWriter) end() {
+	w.WriteByte(0) // STOP
+	w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.lastIDs[len(w.lastIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.WriteByte(typ)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) i32(id int16, n int32) {
+	w.field(id, thriftI32)
+	w.varint(int64(n))
+}
+
+func (w *thriftWriter) i64(id int16, n int64) {
+	w.field(id, thriftI64)
+	w.varint(n)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.uvarint(uint64(len(s)))
+	w.WriteString(s)
+}
+
+// list() starts a list field of 'n' elements, which are written next
+func (w *thriftWriter) list(id int16, elemType byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		w.WriteByte(0xF0 | elemType)
+		w.uvarint(uint64(n))
+	}
+}
+
+// structField() opens a struct field, closed with end()
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+// parquetColumnChunk is where a column was written, for the footer
+type parquetColumnChunk struct {
+	offset int64 // of its page header
+	size   int64 // of its page header and data
+	values int64
+}
+
+// encodeParquetColumn() encodes a column's values, nil for a null, as the
+// data of a single page. An int64 column is encoded as INT64 and anything
+// else as a UTF8 BYTE_ARRAY.
+func encodeParquetColumn(typ int32, values []interface{}) ([]byte, error) {
+	// definition levels, 1 for a value and 0 for a null, as RLE runs
+	var levels thriftWriter
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && (values[j] == nil) == (values[i] == nil) {
+			j++
+		}
+		levels.uvarint(uint64(j-i) << 1)
+		if values[i] == nil {
+			levels.WriteByte(0)
+		} else {
+			levels.WriteByte(1)
+		}
+		i = j
+	}
+
+	var page bytes.Buffer
+	binary.Write(&page, binary.LittleEndian, uint32(levels.Len()))
+	page.Write(levels.Bytes())
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case int64:
+			if typ != parquetInt64 {
+				return nil, fmt.Errorf("unexpected integer %d in a string column", v)
+			}
+			binary.Write(&page, binary.LittleEndian, v)
+		case string:
+			if typ != parquetByteArray {
+				return nil, fmt.Errorf("unexpected string %q in an integer column", v)
+			}
+			binary.Write(&page, binary.LittleEndian, uint32(len(v)))
+			page.WriteString(v)
+		default:
+			return nil, fmt.Errorf("unsupported value %v of type %T", v, v)
+		}
+	}
+	return page.Bytes(), nil
+}
+
+// writeParquet() writes the rows as a Parquet file, each row holding a value
+// per column
+func writeParquet(out io.Writer, columns []exportColumn, rows [][]interface{}) error {
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+
+	chunks := make([]parquetColumnChunk, len(columns))
+	for i, col := range columns {
+		values := make([]interface{}, len(rows))
+		for r, row := range rows {
+			values[r] = row[i]
+		}
+		data, err := encodeParquetColumn(col.parquetType(), values)
+		if err != nil {
+			return fmt.Errorf("Failed to encode column %s => %s", col.Name, err.Error())
+		}
+
+		var header thriftWriter
+		header.begin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(data))) // uncompressed
+		header.i32(3, int32(len(data))) // compressed
+		header.structField(5)           // DataPageHeader
+		header.i32(1, int32(len(values)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE) // definition levels
+		header.i32(4, parquetRLE) // repetition levels
+		header.end()
+		header.end()
+
+		chunks[i] = parquetColumnChunk{
+			offset: int64(file.Len()),
+			size:   int64(header.Len() + len(data)),
+			values: int64(len(values)),
+		}
+		file.Write(header.Bytes())
+		file.Write(data)
+	}
+
+	footer := parquetFooter(columns, chunks, int64(len(rows)))
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.WriteString(parquetMagic)
+
+	_, err := file.WriteTo(out)
+	return err
+}
+
+// parquetFooter() encodes the FileMetaData of a file of one row group
+func parquetFooter(columns []exportColumn, chunks []parquetColumnChunk, numRows int64) []byte {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, 1) // version
+
+	w.list(2, thriftStruct, len(columns)+1) // schema, the root and then each column
+	w.begin()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(columns)))
+	w.end()
+	for _, col := range columns {
+		w.begin()
+		w.i32(1, col.parquetType())
+		w.i32(3, parquetOptional)
+		w.binary(4, col.Name)
+		if col.parquetType() == parquetByteArray {
+			w.i32(6, parquetUTF8)
+		}
+		w.end()
+	}
+	w.i64(3, numRows)
+
+	w.list(4, thriftStruct, 1) // row groups
+	w.begin()
+	w.list(1, thriftStruct, len(columns))
+	var total int64
+	for i, col := range columns {
+		c := chunks[i]
+		total += c.size
+		w.begin()
+		w.i64(2, c.offset)
+		w.structField(3) // ColumnMetaData
+		w.i32(1, col.parquetType())
+		w.list(2, thriftI32, 2) // encodings
+		w.varint(parquetPlain)
+		w.varint(parquetRLE)
+		w.list(3, thriftBinary, 1) // path in schema
+		w.uvarint(uint64(len(col.Name)))
+		w.WriteString(col.Name)
+		w.i32(4, 0) // uncompressed
+		w.i64(5, c.values)
+		w.i64(6, c.size)
+		w.i64(7, c.size)
+		w.i64(9, c.offset) // data page offset
+		w.end()
+		w.end()
+	}
+	w.i64(2, total)
+	w.i64(3, numRows)
+	w.end()
+
+	w.binary(6, "dataupdates") // created by
+	w.end()
+	return w.Bytes()
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestThriftWriter(t *testing.T) {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, 3)        // short field header, zigzag 3 => 6
+	w.binary(20, "ab") // field id too far for a delta
+	w.list(21, thriftI32, 15)
+	w.end()
+
+	expected := []byte{0x15, 0x06, 0x08, 0x28, 0x02, 'a', 'b', 0x19, 0xF5, 0x0F, 0x00}
+	if !bytes.Equal(w.Bytes(), expected) {
+		t.Errorf("Expected % x, found % x", expected, w.Bytes())
+	}
+}
+
+func TestEncodeParquetColumn(t *testing.T) {
+	page, err := encodeParquetColumn(parquetByteArray, []interface{}{"a", "a", nil, "bc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// runs of 2 values, 1 null and 1 value, then the values with their lengths
+	expected := []byte{6, 0, 0, 0, 4, 1, 2, 0, 2, 1, 1, 0, 0, 0, 'a', 1, 0, 0, 0, 'a', 2, 0, 0, 0, 'b', 'c'}
+	if !bytes.Equal(page, expected) {
+		t.Errorf("Expected % x, found % x", expected, page)
+	}
+
+	if _, err := encodeParquetColumn(parquetInt64, []interface{}{"13704"}); err == nil {
+		t.Error("Expected an error for a string in an integer column")
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	columns := []exportColumn{{Name: "course", Type: "string"}, {Name: "callnumber", Type: "int64"}}
+	rows := [][]interface{}{{"ACTU4850", int64(13704)}, {nil, int64(13705)}}
+
+	var buf bytes.Buffer
+	if err := writeParquet(&buf, columns, rows); err != nil {
+		t.Fatalf("Failed to write Parquet => %s", err.Error())
+	}
+	file := buf.Bytes()
+	if string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+		t.Fatalf("Expected the file to start and end with %s", parquetMagic)
+	}
+
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := file[len(file)-8-footerLen : len(file)-8]
+	for _, s := range []string{"course", "callnumber", "dataupdates"} {
+		if !bytes.Contains(footer, []byte(s)) {
+			t.Errorf("Expected %s in the footer", s)
+		}
+	}
+	if !bytes.Contains(file[:len(file)-8-footerLen], []byte("ACTU4850")) {
+		t.Error("Expected the course to be written before the footer")
+	}
+}
+
+// thriftReader decodes the thrift compact protocol independently of
+// thriftWriter, reading a struct as a map of field id to value: an int64, a
+// []byte, a []interface{} or a nested struct
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.b) {
+		panic("thrift: unexpected end of data")
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.b[r.pos:])
+	if size <= 0 {
+		panic("thrift: bad varint")
+	}
+	r.pos += size
+	return n
+}
+
+func (r *thriftReader) varint() int64 {
+	n := r.uvarint()
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2: // booleans, true and false
+		return typ == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.varint()
+	case 8:
+		n := int(r.uvarint())
+		r.pos += n
+		return r.b[r.pos-n : r.pos]
+	case 9, 10:
+		header := r.byte()
+		n, elemType := int(header>>4), header&0x0F
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if elemType == 1 || elemType == 2 {
+				list[i] = r.byte() == 1
+			} else {
+				list[i] = r.value(elemType)
+			}
+		}
+		return list
+	case 12:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("thrift: unsupported type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var id int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0F)
+	}
+}
+
+// readParquet() reads back a file of optional INT64 and UTF8 BYTE_ARRAY
+// columns in PLAIN encoded, uncompressed data pages, by their offsets in the
+// footer
+func readParquet(file []byte) (columns []exportColumn, rows [][]interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	if len(file) < 12 || string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+		return nil, nil, fmt.Errorf("missing the %s magic", parquetMagic)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footerStart := len(file) - 8 - footerLen
+	meta := (&thriftReader{b: file[footerStart : len(file)-8]}).structure()
+
+	schema := meta[2].([]interface{})
+	root := schema[0].(map[int16]interface{})
+	if root[5].(int64) != int64(len(schema)-1) {
+		return nil, nil, fmt.Errorf("the root has %d children for %d columns", root[5], len(schema)-1)
+	}
+	for _, e := range schema[1:] {
+		e := e.(map[int16]interface{})
+		if e[3].(int64) != parquetOptional {
+			return nil, nil, fmt.Errorf("expected an optional column, found %v", e)
+		}
+		c := exportColumn{Name: string(e[4].([]byte)), Type: "string"}
+		switch {
+		case e[1].(int64) == parquetInt64 && e[6] == nil:
+			c.Type = "int64"
+		case e[1].(int64) != parquetByteArray || e[6] != int64(parquetUTF8):
+			return nil, nil, fmt.Errorf("unexpected column type %v", e)
+		}
+		columns = append(columns, c)
+	}
+
+	numRows := int(meta[3].(int64))
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 {
+		return nil, nil, fmt.Errorf("expected a single row group, found %d", len(groups))
+	}
+	group := groups[0].(map[int16]interface{})
+	chunks := group[1].([]interface{})
+	if len(chunks) != len(columns) || group[3].(int64) != int64(numRows) {
+		return nil, nil, fmt.Errorf("expected %d chunks of %d rows, found %v", len(columns), numRows, group)
+	}
+
+	rows = make([][]interface{}, numRows)
+	for i := range rows {
+		rows[i] = make([]interface{}, len(columns))
+	}
+	var total int64
+	for i, chunk := range chunks {
+		cm := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		if path := cm[3].([]interface{}); len(path) != 1 || string(path[0].([]byte)) != columns[i].Name {
+			return nil, nil, fmt.Errorf("chunk %d is for %v, not %s", i, path, columns[i].Name)
+		}
+		if cm[4].(int64) != 0 || cm[5].(int64) != int64(numRows) {
+			return nil, nil, fmt.Errorf("expected %d uncompressed values in %s, found %v", numRows, columns[i].Name, cm)
+		}
+		total += cm[7].(int64)
+
+		r := &thriftReader{b: file, pos: int(cm[9].(int64))}
+		header := r.structure()
+		size := int(header[3].(int64))
+		if header[1].(int64) != parquetDataPage || header[2].(int64) != int64(size) || r.pos+size > footerStart {
+			return nil, nil, fmt.Errorf("unexpected page header %v", header)
+		}
+		if int64(r.pos+size)-cm[9].(int64) != cm[7].(int64) {
+			return nil, nil, fmt.Errorf("the chunk size of %s does not match its page", columns[i].Name)
+		}
+		dph := header[5].(map[int16]interface{})
+		if dph[1].(int64) != int64(numRows) || dph[2].(int64) != parquetPlain || dph[3].(int64) != parquetRLE {
+			return nil, nil, fmt.Errorf("unexpected data page header %v", dph)
+		}
+		page := file[r.pos : r.pos+size]
+
+		// definition levels: RLE and bit-packed runs of a bit width of 1
+		levelsLen := int(binary.LittleEndian.Uint32(page))
+		lr := &thriftReader{b: page[4 : 4+levelsLen]}
+		var defined []bool
+		for lr.pos < len(lr.b) {
+			h := lr.uvarint()
+			if h&1 == 0 {
+				v := lr.byte() == 1
+				for n := h >> 1; n > 0; n-- {
+					defined = append(defined, v)
+				}
+			} else {
+				for n := int(h>>1) * 8; n > 0; n -= 8 {
+					b := lr.byte()
+					for bit := 0; bit < 8; bit++ {
+						defined = append(defined, b&(1<<bit) != 0)
+					}
+				}
+			}
+		}
+		if len(defined) < numRows {
+			return nil, nil, fmt.Errorf("found %d definition levels for %d rows in %s", len(defined), numRows, columns[i].Name)
+		}
+
+		values := page[4+levelsLen:]
+		for row := 0; row < numRows; row++ {
+			if !defined[row] {
+				continue
+			}
+			if columns[i].Type == "int64" {
+				rows[row][i] = int64(binary.LittleEndian.Uint64(values))
+				values = values[8:]
+			} else {
+				n := int(binary.LittleEndian.Uint32(values))
+				rows[row][i] = string(values[4 : 4+n])
+				values = values[4+n:]
+			}
+		}
+		if len(values) != 0 {
+			return nil, nil, fmt.Errorf("%d bytes left over in %s", len(values), columns[i].Name)
+		}
+	}
+	if group[2].(int64) != total {
+		return nil, nil, fmt.Errorf("the row group size %d is not the sum of its chunks, %d", group[2], total)
+	}
+	return columns, rows, nil
+}
+
+// roundTripColumns are enough columns to need a long list header
+func roundTripColumns() []exportColumn {
+	columns := []exportColumn{{Name: "course", Type: "string"}, {Name: "callnumber", Type: "int64"}}
+	for i := len(columns); i < 17; i++ {
+		columns = append(columns, exportColumn{Name: fmt.Sprintf("extra%d", i), Type: []string{"string", "int64"}[i%2]})
+	}
+	return columns
+}
+
+func roundTripRows(columns []exportColumn) [][]interface{} {
+	var rows [][]interface{}
+	for r := 0; r < 40; r++ {
+		row := make([]interface{}, len(columns))
+		for i, c := range columns {
+			switch {
+			case (r+i)%7 == 0 || r >= 30 && i == 0: // scattered nulls and a long run of them
+			case c.Type == "int64":
+				row[i] = int64(r*1000-5000) * int64(i+1)
+			case r%5 == 0:
+				row[i] = ""
+			default:
+				row[i] = fmt.Sprintf("Économie %d-%d", r, i)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	columns := roundTripColumns()
+	for _, rows := range [][][]interface{}{roundTripRows(columns), nil} {
+		var buf bytes.Buffer
+		if err := writeParquet(&buf, columns, rows); err != nil {
+			t.Fatalf("Failed to write Parquet => %s", err.Error())
+		}
+		readColumns, readRows, err := readParquet(buf.Bytes())
+		if err != nil {
+			t.Fatalf("Failed to read the Parquet file back => %s", err.Error())
+		}
+		if !reflect.DeepEqual(readColumns, columns) {
+			t.Errorf("Expected the columns %v, found %v", columns, readColumns)
+		}
+		if len(readRows) != len(rows) {
+			t.Fatalf("Expected %d rows, found %d", len(rows), len(readRows))
+		}
+		for i := range rows {
+			if !reflect.DeepEqual(readRows[i], rows[i]) {
+				t.Errorf("Expected row %d to be %v, found %v", i, rows[i], readRows[i])
+			}
+		}
+	}
+}
+
+// TestParquetPyArrow reads a file with pyarrow when it is installed, as CI
+// does, checking the file against a reader the export is meant for
+func TestParquetPyArrow(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import pyarrow").Run(); err != nil {
+		t.Skip("pyarrow is not installed")
+	}
+	columns := roundTripColumns()
+	rows := roundTripRows(columns)
+	filename := filepath.Join(t.TempDir(), "rows.parquet")
+	err := writeExportFile(filename, func(w io.Writer) error { return writeParquet(w, columns, rows) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := `import json, sys, pyarrow.parquet as pq
+table = pq.read_table(sys.argv[1])
+print(json.dumps({"types": [str(f.type) for f in table.schema], "rows": table.to_pylist()}))`
+	out, err := exec.Command("python3", "-c", script, filename).Output()
+	if err != nil {
+		t.Fatalf("pyarrow failed to read the file => %s", err.Error())
+	}
+	var read struct {
+		Types []string
+		Rows  []map[string]interface{}
+	}
+	if err := json.Unmarshal(out, &read); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range columns {
+		expected := map[string]string{"string": "string", "int64": "int64"}[c.Type]
+		if read.Types[i] != expected {
+			t.Errorf("Expected %s to be read as %s, found %s", c.Name, expected, read.Types[i])
+		}
+	}
+	if len(read.Rows) != len(rows) {
+		t.Fatalf("Expected %d rows, found %d", len(rows), len(read.Rows))
+	}
+	for r, row := range rows {
+		for i, c := range columns {
+			found := read.Rows[r][c.Name]
+			if n, ok := found.(float64); ok {
+				found = int64(n)
+			}
+			if found != row[i] {
+				t.Errorf("Expected %s of row %d to be %v, found %v", c.Name, r, row[i], found)
+			}
+		}
+	}
+}
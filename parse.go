@@ -1,83 +1,54 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
-	"os"
-	"sync"
+	"log/slog"
 )
 
-// readByteSkippingSpace() reads through an io.Reader until a character that is
-// not whitespace is encountered
-func readByteSkippingSpace(r io.Reader) (b byte, err error) {
-	buf := make([]byte, 1)
-	for {
-		_, err := r.Read(buf)
-		if err != nil {
-			return 0, err
-		}
-		b := buf[0]
-		switch b {
-		// Only handling ASCII white space for now
-		case ' ', '\t', '\n', '\v', '\f', '\r':
-			continue
-		default:
-			return b, nil
-		}
-	}
-}
-
-// parseCourses() reads in 'jsonFileName' and parses courses while sending them down
-// the 'cChan' channel for processing. 'wg' is marked as done when the end of the
-// json list is found.
-func parseCourses(jsonFileName string, cChan chan Course, wg *sync.WaitGroup) {
-	// open file for parsing
-	file, err := os.OpenFile(jsonFileName, os.O_RDONLY, 0644)
-	if err != nil {
-		log.Fatalf("Failed to open file, %s, with error: %s", jsonFileName, err.Error())
-	}
-
-	//defer file.Close() to close after all parsing is finished
-	r := io.Reader(file)
+// parseCourses() streams the JSON array of courses in 'r' down the 'cChan'
+// channel for processing. 'cChan' is always closed on return, and an error is
+// returned if the input is malformed or 'ctx' is cancelled before the end of
+// the json list is found.
+func parseCourses(ctx context.Context, r io.Reader, cChan chan<- Course, stats *runStats) error {
+	defer close(cChan)
+	dec := json.NewDecoder(r)
 
-	// Skip whitespace & '['
-	if b, err := readByteSkippingSpace(r); err != nil {
-		panic(err)
-	} else if b != '[' {
-		panic("Input is not a JSON array")
+	// the input must open with '['
+	if t, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read start of JSON array => %s", err.Error())
+	} else if d, ok := t.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("input is not a JSON array, found %v", t)
 	}
 
 	// now we start decoding each of the courses
-	var c Course
-	for {
-		c = Course{} // zero out the course for reuse
-		dec := json.NewDecoder(r)
-		if err := dec.Decode(&c); err == io.EOF {
-			log.Print("finished parsing json file")
-			return
-		} else if err != nil {
-			panic(err)
+	for dec.More() {
+		var c Course
+		if err := dec.Decode(&c); err != nil {
+			return fmt.Errorf("failed to decode course => %s", err.Error())
+		}
+		stats.add(parsedRecords, 1)
+		if err := c.fill(); err != nil {
+			stats.add(rejectedRecords, 1)
+			slog.Warn("skipping course", "course", c.Course, "err", err.Error())
+			continue
 		}
-		c.fill()
-		cChan <- c
 
-		r = io.MultiReader(dec.Buffered(), r)
-		if b, err := readByteSkippingSpace(r); err != nil {
-			log.Printf("broken, hit %s, err => %s", string(b), err.Error())
-			panic(err)
-		} else {
-			switch b {
-			case ',':
-				continue
-			case ']':
-				log.Print("done reading json list")
-				close(cChan)
-				wg.Done()
-				return
-			default:
-				panic("Invalid character in JSON data: " + string([]byte{b}))
-			}
+		select {
+		case cChan <- c:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+
+	// and must close with ']'
+	if t, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read end of JSON array => %s", err.Error())
+	} else if d, ok := t.(json.Delim); !ok || d != ']' {
+		return fmt.Errorf("invalid token in JSON data, %v", t)
+	}
+	slog.Info("done reading json list", "courses", stats.get(parsedRecords))
+	return nil
 }
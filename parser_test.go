@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var expectedDescriptions = map[string]bool{
@@ -27,3 +34,129 @@ func TestGetDescription(t *testing.T) {
 		}
 	}
 }
+
+var expectedInstructors = map[string][]string{
+	"ACTUK4850": {"John N Vitucci", "Lisa Minetti"},
+	"ACTUK4620": {"John N Vitucci"},
+}
+
+func TestParsePageInstructors(t *testing.T) {
+	for fn, expected := range expectedInstructors {
+		page, err := ioutil.ReadFile(fmt.Sprintf("./test_files/%s.html", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if names := parsePageInstructors(page); !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected instructors %v in %s, found %v", expected, fn, names)
+		}
+	}
+}
+
+// sectionPages are the bulletin pages of two sections of one course, which
+// share a description but not their instructors
+var sectionPages = map[string]string{ // path --> instructors
+	"/subj/ACTU/K4850-20143-001/": "John N Vitucci",
+	"/subj/ACTU/K4850-20143-002/": "Lisa Minetti",
+}
+
+func TestScrapeDescriptionsPerSection(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, "<tr valign=top><td bgcolor=#99CCFF>Instructors</td>\n <td bgcolor=#DADADA>%s</td></tr>\n"+
+			"<tr valign=top><td bgcolor=#99CCFF>Course Description</td>\n <td bgcolor=#DADADA>A workshop.</td></tr>\n"+
+			"<tr valign=top><td bgcolor=#99CCFF>Web Site</td>", sectionPages[r.URL.Path])
+	}))
+	defer srv.Close()
+	oldBulletin := bulletinURL
+	bulletinURL = srv.URL + "/"
+	defer func() { bulletinURL = oldBulletin }()
+
+	in, out := make(chan Course, 3), make(chan Course, 3)
+	for _, course := range []string{"ACTUK4850K001", "ACTUK4850K002", "ACTUK4850K001"} {
+		c := Course{Course: course, Section: Section{Term: "20143"}}
+		if err := c.fill(); err != nil {
+			t.Fatal(err)
+		}
+		in <- c
+	}
+	close(in)
+	if err := scrapeDescriptions(context.Background(), in, out, newRunStats(time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	for c := range out {
+		expected := sectionPages[strings.TrimPrefix(c.BulletinURL, srv.URL)]
+		if !reflect.DeepEqual(c.BulletinInstructors, []string{expected}) || c.Description != "A workshop." {
+			t.Errorf("Expected %s to be described with instructor %s, found %v and %q", c.Course, expected, c.BulletinInstructors, c.Description)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n < 2 || n > 3 {
+		t.Errorf("Expected a bulletin request per section, found %d", n)
+	}
+}
+
+var parseCoursesInputs = map[string]bool{ // input --> expect an error
+	`[]`: false,
+	`[{"Course":"COMS4995W001","Term":"20143"}, {"Course":"ACTUK4850K001","Term":"20143"}]`: false,
+	`[{"Course":"bad"}]`:                       false, // unparseable course codes are skipped
+	`{"Course":"COMS4995W001"}`:                true,
+	`[{"Course":"COMS4995W001"}`:               true,
+	`[{"Course":"COMS4995W001"} {"Course":1}]`: true,
+	``: true,
+}
+
+func TestParseCourses(t *testing.T) {
+	for input, expectErr := range parseCoursesInputs {
+		cChan := make(chan Course)
+		errChan := make(chan error, 1)
+		stats := newRunStats(time.Now())
+		go func() { errChan <- parseCourses(context.Background(), strings.NewReader(input), cChan, stats) }()
+
+		// the channel must close for every input, malformed or not
+		for c := range cChan {
+			if c.CourseFull == "" {
+				t.Errorf("Expected only filled courses from %s", input)
+			}
+		}
+		if err := <-errChan; (err != nil) != expectErr {
+			t.Errorf("Unexpected error result for %s => %v", input, err)
+		}
+		if input == `[{"Course":"bad"}]` && (stats.get(parsedRecords) != 1 || stats.get(rejectedRecords) != 1) {
+			t.Errorf("Expected the bad course to be counted as parsed and rejected, found %d and %d",
+				stats.get(parsedRecords), stats.get(rejectedRecords))
+		}
+	}
+}
+
+func TestParseCoursesCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cChan := make(chan Course) // never read, so only cancellation can unblock the parser
+	err := parseCourses(ctx, strings.NewReader(`[{"Course":"COMS4995W001"}]`), cChan, nil)
+	if err != context.Canceled {
+		t.Errorf("Expected the parser to stop on cancel, got %v", err)
+	}
+	if _, more := <-cChan; more {
+		t.Error("Expected the course channel to be closed")
+	}
+}
+
+var bulletinURLInputs = map[string]string{ // Course --> BulletinURL
+	"COMS4995W001": "http://www.columbia.edu/cu/bulletin/uwb/subj/COMS/W4995-20143-001/",
+	"ART 1010V001": "http://www.columbia.edu/cu/bulletin/uwb/subj/ART/V1010-20143-001/",
+	"ECON1105BR01": "http://www.columbia.edu/cu/bulletin/uwb/subj/ECON/B1105-20143-R01/",
+	"bad":          "",
+}
+
+func TestSetBulletinURL(t *testing.T) {
+	for course, expected := range bulletinURLInputs {
+		c := Course{Course: course, Section: Section{Term: "20143"}}
+		c.setBulletinURL()
+		if c.BulletinURL != expected {
+			t.Errorf("Expected %s to link to %q, found %q", course, expected, c.BulletinURL)
+		}
+	}
+}
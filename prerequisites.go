@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/natebrennand/dataupdates/requisites"
+)
+
+// courseRequisites are the requisites found in a course's description
+type courseRequisites struct {
+	Course string // EX: COMS4118
+	requisites.Requisites
+}
+
+// readRequisites() extracts the requisites of every stored course
+func readRequisites(ctx context.Context, db *sql.DB) ([]courseRequisites, error) {
+	rows, err := db.QueryContext(ctx, `SELECT course, coalesce(description, '') FROM courses_v2_t ORDER BY course`)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying course descriptions => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var found []courseRequisites
+	for rows.Next() {
+		var course, description string
+		if err := rows.Scan(&course, &description); err != nil {
+			return nil, fmt.Errorf("Error while processing course descriptions => %s", err.Error())
+		}
+		r := courseRequisites{Course: course, Requisites: requisites.Extract(description)}
+		if r.Text != "" || len(r.CrossListings) > 0 {
+			found = append(found, r)
+		}
+	}
+	return found, rows.Err()
+}
+
+// updateRequisites() replaces the rows of 'prerequisites_t' and
+// 'cross_listings_t' with those extracted from the stored descriptions, so
+// they always follow the latest description of each course
+func updateRequisites(ctx context.Context, db *sql.DB) error {
+	found, err := readRequisites(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"prerequisites_t", "cross_listings_t"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+			return fmt.Errorf("Failed to clear %s => %s", table, err.Error())
+		}
+	}
+
+	var prerequisites, crossListings int
+	for _, r := range found {
+		if r.Text != "" {
+			var expression interface{} // NULL if nothing in the text was understood
+			if r.Prerequisites != nil {
+				b, err := json.Marshal(r.Prerequisites)
+				if err != nil {
+					return fmt.Errorf("Failed to encode prerequisites of %s => %s", r.Course, err.Error())
+				}
+				expression = string(b)
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO prerequisites_t (course, text, expression) VALUES ($1, $2, $3)`,
+				r.Course, r.Text, expression,
+			)
+			if err != nil {
+				return fmt.Errorf("Failed to insert prerequisites_t, %s => %s", r.Course, err.Error())
+			}
+			prerequisites++
+		}
+
+		for _, other := range r.CrossListings {
+			if other == r.Course {
+				continue
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO cross_listings_t (course, crosslisted) VALUES ($1, $2)`,
+				r.Course, other,
+			)
+			if err != nil {
+				return fmt.Errorf("Failed to insert cross_listings_t, %s => %s", r.Course, err.Error())
+			}
+			crossListings++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit requisites => %s", err.Error())
+	}
+	slog.Info("extracted requisites", "prerequisites", prerequisites, "cross_listings", crossListings)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestUpdateRequisites(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	store, err := newSQLiteCourseStore(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range sqliteCatalogTables {
+		if !strings.Contains(query, "fts5") {
+			if _, err := db.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	descriptions := map[string]string{
+		"COMS4118": "Operating systems. Prerequisites: COMS W3157 and W3827. Cross-listed with CSEE W4118 and COMS W4118.",
+		"COMS3157": "Advanced programming.",
+	}
+	for course, description := range descriptions {
+		c := testSection
+		c.ShortCourse, c.Description = course, description
+		if err := store.UpsertCourse(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ { // a second run replaces the first
+		if err := updateRequisites(ctx, db); err != nil {
+			t.Fatalf("Failed to update requisites => %s", err.Error())
+		}
+	}
+
+	var course, text, expression string
+	err = db.QueryRow(`SELECT course, text, expression FROM prerequisites_t`).Scan(&course, &text, &expression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if course != "COMS4118" || text != "COMS W3157 and W3827" || expression != `{"All":[{"Course":"COMS3157"},{"Course":"COMS3827"}]}` {
+		t.Errorf("Expected the prerequisites of COMS4118, found %s %q %s", course, text, expression)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM prerequisites_t`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("Expected a single row of prerequisites, found %d (%v)", n, err)
+	}
+	var crossListed string
+	if err := db.QueryRow(`SELECT group_concat(crosslisted) FROM cross_listings_t`).Scan(&crossListed); err != nil {
+		t.Fatal(err)
+	}
+	if crossListed != "CSEE4118" {
+		t.Errorf("Expected COMS4118 to be cross-listed with CSEE4118 but not itself, found %s", crossListed)
+	}
+}
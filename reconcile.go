@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// sectionSet holds the call numbers found for each term in a load
+type sectionSet map[string]map[string]bool // term --> callnumber --> true
+
+func (s sectionSet) add(term, callNumber string) {
+	if s[term] == nil {
+		s[term] = make(map[string]bool)
+	}
+	s[term][callNumber] = true
+}
+
+// terms() lists the terms found in the load, in order
+func (s sectionSet) terms() []string {
+	terms := make([]string, 0, len(s))
+	for term := range s {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// missingSections() lists the stored sections, 'active', that were not found
+// in the load
+func (s sectionSet) missingSections(term string, active map[string]string) []string {
+	var missing []string
+	for callNumber := range active {
+		if !s[term][callNumber] {
+			missing = append(missing, callNumber)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+var activeSectionsQuery = `
+SELECT callnumber, course
+ FROM sections_v2_t
+ WHERE term = $1 AND cancelled_at IS NULL;
+`
+
+// activeSections() maps the call number of each section stored for the term
+// that has not been cancelled to its course
+func activeSections(ctx context.Context, db *sql.DB, term string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, activeSectionsQuery, term)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying sections of %s => %s", term, err.Error())
+	}
+	defer rows.Close()
+
+	active := make(map[string]string)
+	for rows.Next() {
+		var callNumber, course string
+		if err := rows.Scan(&callNumber, &course); err != nil {
+			return nil, fmt.Errorf("Error while processing sections of %s => %s", term, err.Error())
+		}
+		active[callNumber] = course
+	}
+	return active, rows.Err()
+}
+
+// reconcileSections() soft deletes the sections of each loaded term that are
+// no longer in the registrar feed, recording a section_cancelled event for
+// each. A term is left untouched, and an error returned, when more than
+// 'maxRemoved' of its sections would be removed, since that is far more likely
+// to be a truncated feed than a wave of cancellations.
+func reconcileSections(ctx context.Context, db *sql.DB, seen sectionSet, maxRemoved float64) error {
+	for term := range seen {
+		active, err := activeSections(ctx, db, term)
+		if err != nil {
+			return err
+		}
+		missing := seen.missingSections(term, active)
+		if len(missing) == 0 {
+			continue
+		}
+
+		if removed := float64(len(missing)) / float64(len(active)); removed > maxRemoved {
+			return fmt.Errorf("refusing to cancel %d of %d sections in %s, %.0f%% is over the %.0f%% limit",
+				len(missing), len(active), term, 100*removed, 100*maxRemoved)
+		}
+
+		if err := cancelSections(ctx, db, term, missing, active); err != nil {
+			return err
+		}
+		slog.Info("cancelled missing sections", "term", term, "sections", len(missing))
+	}
+	return nil
+}
+
+// cancelSections() marks the sections cancelled and records the events in a
+// single transaction
+func cancelSections(ctx context.Context, db *sql.DB, term string, callNumbers []string, courses map[string]string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE sections_v2_t SET cancelled_at = now() WHERE term = $1 AND callnumber = ANY($2::integer[])`,
+		term,
+		"{"+strings.Join(callNumbers, ",")+"}",
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to cancel sections of %s => %s", term, err.Error())
+	}
+
+	for _, callNumber := range callNumbers {
+		e := changeEvent{
+			Kind:       eventSectionCancelled,
+			Term:       term,
+			CallNumber: callNumber,
+			Course:     courses[callNumber],
+			New:        "removed from feed",
+		}
+		if err := e.Insert(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingSections(t *testing.T) {
+	seen := make(sectionSet)
+	seen.add("20143", "13704")
+	seen.add("20143", "13705")
+	seen.add("20151", "20001")
+
+	active := map[string]string{
+		"13704": "ACTU4850",
+		"13705": "ACTU4850",
+		"13706": "ACTU4620",
+		"13707": "ACTU4620",
+	}
+	if missing := seen.missingSections("20143", active); !reflect.DeepEqual(missing, []string{"13706", "13707"}) {
+		t.Errorf("Expected the unseen sections to be missing, found %v", missing)
+	}
+	if missing := seen.missingSections("20151", map[string]string{"20001": "COMS4995"}); len(missing) != 0 {
+		t.Errorf("Expected no missing sections, found %v", missing)
+	}
+}
+
+func TestSectionSetTerms(t *testing.T) {
+	seen := make(sectionSet)
+	seen.add("20151", "20001")
+	seen.add("20143", "13704")
+	seen.add("20143", "13705")
+	if terms := seen.terms(); !reflect.DeepEqual(terms, []string{"20143", "20151"}) {
+		t.Errorf("Expected the terms in order, found %v", terms)
+	}
+}
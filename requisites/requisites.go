@@ -0,0 +1,369 @@
+// Package requisites extracts the prerequisites and cross-listings of a course
+// from its bulletin description, EX: "Prerequisites: COMS W3134 and W3157 or
+// the instructor's permission."
+package requisites
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/natebrennand/dataupdates/coursecode"
+)
+
+// Requirement is a node of a prerequisite expression: a single course, the
+// instructor's permission, or every one (All) or any one (Any) of its parts
+type Requirement struct {
+	Course     string        `json:",omitempty"` // EX: COMS3134
+	Permission bool          `json:",omitempty"`
+	All        []Requirement `json:",omitempty"`
+	Any        []Requirement `json:",omitempty"`
+}
+
+// String is the expression with explicit operators, EX:
+// "(COMS3134 AND COMS3157) OR permission"
+func (r Requirement) String() string {
+	join := func(parts []Requirement, op string) string {
+		s := make([]string, len(parts))
+		for i, p := range parts {
+			s[i] = p.String()
+			if len(p.All)+len(p.Any) > 0 {
+				s[i] = "(" + s[i] + ")"
+			}
+		}
+		return strings.Join(s, op)
+	}
+	switch {
+	case r.Course != "":
+		return r.Course
+	case r.Permission:
+		return "permission"
+	case len(r.All) > 0:
+		return join(r.All, " AND ")
+	}
+	return join(r.Any, " OR ")
+}
+
+// Courses lists every course named in the expression, in order and without
+// duplicates
+func (r Requirement) Courses() []string {
+	var courses []string
+	seen := make(map[string]bool)
+	var walk func(r Requirement)
+	walk = func(r Requirement) {
+		if r.Course != "" && !seen[r.Course] {
+			seen[r.Course] = true
+			courses = append(courses, r.Course)
+		}
+		for _, p := range append(r.All, r.Any...) {
+			walk(p)
+		}
+	}
+	walk(r)
+	return courses
+}
+
+// Requisites are what a description says about a course's prerequisites and
+// cross-listings
+type Requisites struct {
+	Text          string       // the prerequisite sentence, EX: "COMS W3134 and W3157"
+	Prerequisites *Requirement // nil if no course or permission was recognized
+	CrossListings []string     // EX: ["MATH3020"]
+}
+
+var (
+	// a prerequisite clause, up to the end of its sentence, EX: "Prerequisite(s): ..."
+	prerequisiteClause = regexp.MustCompile(`(?i)\bPrerequisites?\s*(?:\([^)]*\))?\s*:\s*([^.]*)`)
+
+	// a cross-listing sentence
+	crossListingClause = regexp.MustCompile(`(?i)\b(?:cross-?listed (?:with|as)|also (?:listed|offered) as|same as)\b([^.]*)`)
+
+	// a course, EX: "COMS W3134", "COMSW3134", "W3157", "ECON BC3035" or
+	// "MATH 1101". A bare number, EX: "1601", is only a course in a list.
+	courseRef = regexp.MustCompile(`\b(?:([A-Z]{2,4})\s?)?([A-Z]{1,2})?\s?(\d{4})\b`)
+
+	// what may separate the courses of a list, EX: ", or "
+	listSeparator = regexp.MustCompile(`(?i)^(?:[\s,;&()]|\band\b|\bor\b)*$`)
+
+	// the ways the instructor's permission is asked for
+	permission = regexp.MustCompile(`(?i)(?:the\s+)?instructor(?:'s|’s|s'|s)?\s+(?:permission|approval|consent)|(?:permission|approval|consent)\s+of\s+(?:the\s+)?instructor`)
+
+	// everything else the tokenizer cares about
+	conjunction = regexp.MustCompile(`(?i)\b(?:and|or)\b|[,;()&]`)
+)
+
+// Extract finds the prerequisites and cross-listings in a description
+func Extract(description string) Requisites {
+	var r Requisites
+	if m := prerequisiteClause.FindStringSubmatch(description); m != nil {
+		r.Text = strings.TrimSpace(m[1])
+		r.Prerequisites = Parse(r.Text)
+	}
+	for _, m := range crossListingClause.FindAllStringSubmatch(description, -1) {
+		for _, t := range tokenize(m[1]) {
+			if t.kind == tokenCourse {
+				r.CrossListings = append(r.CrossListings, t.course)
+			}
+		}
+	}
+	if len(r.CrossListings) > 0 {
+		sort.Strings(r.CrossListings)
+		r.CrossListings = dedupe(r.CrossListings)
+	}
+	return r
+}
+
+func dedupe(sorted []string) []string {
+	out := sorted[:1]
+	for _, s := range sorted[1:] {
+		if s != out[len(out)-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type tokenKind int
+
+const (
+	tokenCourse tokenKind = iota
+	tokenPermission
+	tokenAnd
+	tokenOr
+	tokenComma
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind   tokenKind
+	course string // EX: COMS3134, for a course
+}
+
+// tokenize() reads the courses, permission and conjunctions of 'text' in
+// order, skipping any other words. A course without a department, EX: "W3157",
+// "BC3033" or a bare "1601" in a list, takes the department of the course
+// before it. Symbols are read by the coursecode package's rules.
+func tokenize(text string) []token {
+	type match struct {
+		start int
+		token
+	}
+	var matches []match
+
+	// permission first, so its words are not read as anything else
+	for _, loc := range permission.FindAllStringIndex(text, -1) {
+		matches = append(matches, match{loc[0], token{kind: tokenPermission}})
+		text = text[:loc[0]] + strings.Repeat(" ", loc[1]-loc[0]) + text[loc[1]:]
+	}
+
+	dept, lastEnd := "", 0
+	for _, loc := range courseRef.FindAllStringSubmatchIndex(text, -1) {
+		d, symbol, number := group(text, loc, 1), group(text, loc, 2), group(text, loc, 3)
+		start := loc[0]
+		switch {
+		case d == "AND" || d == "OR": // a conjunction in capitals, EX: "PHYS 1401 OR 1601"
+			d, start = "", loc[6]
+		case d != "" && symbol == "" && len(d) == 2 && coursecode.IsSymbol(d) && dept != "":
+			d, symbol = "", d // EX: "BC3033" in "ECON BC3035 and BC3033"
+		case len(symbol) == 2 && !coursecode.IsSymbol(symbol):
+			continue // letters that are neither a department nor a symbol
+		}
+		if d == "" && symbol == "" && (dept == "" || !listSeparator.MatchString(text[lastEnd:start])) {
+			continue // a year or other number
+		}
+		if d != "" {
+			dept = d
+		} else if dept == "" {
+			continue
+		}
+		matches = append(matches, match{start, token{kind: tokenCourse, course: dept + number}})
+		text = text[:start] + strings.Repeat(" ", loc[1]-start) + text[loc[1]:]
+		lastEnd = loc[1]
+	}
+
+	for _, loc := range conjunction.FindAllStringIndex(text, -1) {
+		var kind tokenKind
+		switch strings.ToLower(text[loc[0]:loc[1]]) {
+		case "and", "&", ";":
+			kind = tokenAnd
+		case "or":
+			kind = tokenOr
+		case ",":
+			kind = tokenComma
+		case "(":
+			kind = tokenOpen
+		case ")":
+			kind = tokenClose
+		}
+		matches = append(matches, match{loc[0], token{kind: kind}})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	tokens := make([]token, len(matches))
+	for i, m := range matches {
+		tokens[i] = m.token
+	}
+	return tokens
+}
+
+func group(s string, loc []int, n int) string {
+	if loc[2*n] < 0 {
+		return ""
+	}
+	return s[loc[2*n]:loc[2*n+1]]
+}
+
+// Parse reads a prerequisite expression, returning nil if it names no course
+// or permission. "or" binds more tightly than "and", as in "COMS W3134 or
+// W3137 and COMS W3203", except that the instructor's permission is an
+// alternative to everything before it. Commas take the meaning of the "and" or
+// "or" that ends their list, EX: "A, B, or C".
+func Parse(text string) *Requirement {
+	tokens := resolveCommas(balance(tokenize(text)))
+
+	// "... or the instructor's permission" at the end applies to the whole
+	if n := len(tokens); n >= 2 && tokens[n-1].kind == tokenPermission && tokens[n-2].kind == tokenOr {
+		rest := (&parser{tokens: tokens[:n-2]}).parseAnd()
+		perm := Requirement{Permission: true}
+		switch {
+		case rest == nil:
+			return &perm
+		case len(rest.Any) > 0:
+			return &Requirement{Any: append(rest.Any, perm)}
+		}
+		return &Requirement{Any: []Requirement{*rest, perm}}
+	}
+	return (&parser{tokens: tokens}).parseAnd()
+}
+
+// balance() drops the parentheses that are never closed or never opened
+func balance(tokens []token) []token {
+	var open []int // indexes of unclosed parentheses in 'out'
+	var out []token
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenOpen:
+			open = append(open, len(out))
+		case tokenClose:
+			if len(open) == 0 {
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+		out = append(out, t)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		out = append(out[:open[i]], out[open[i]+1:]...)
+	}
+	return out
+}
+
+// resolveCommas() replaces each comma with the conjunction that ends its list,
+// or "and" if none does, dropping those directly before a conjunction
+func resolveCommas(tokens []token) []token {
+	var out []token
+	for i, t := range tokens {
+		if t.kind != tokenComma {
+			out = append(out, t)
+			continue
+		}
+		kind, nested := tokenAnd, 0
+	lookahead:
+		for _, next := range tokens[i+1:] {
+			switch {
+			case next.kind == tokenOpen:
+				nested++
+			case next.kind == tokenClose && nested == 0:
+				break lookahead
+			case next.kind == tokenClose:
+				nested--
+			case nested > 0:
+			case next.kind == tokenAnd || next.kind == tokenOr:
+				kind = next.kind
+				break lookahead
+			}
+		}
+		if i+1 < len(tokens) && (tokens[i+1].kind == tokenAnd || tokens[i+1].kind == tokenOr) {
+			continue
+		}
+		out = append(out, token{kind: kind})
+	}
+	return out
+}
+
+// parser reads tokens into a Requirement, skipping operators that are missing
+// an operand
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) parseAnd() *Requirement {
+	return p.parseList(tokenAnd, p.parseOr, func(parts []Requirement) Requirement { return Requirement{All: parts} })
+}
+
+func (p *parser) parseOr() *Requirement {
+	return p.parseList(tokenOr, p.parseAtom, func(parts []Requirement) Requirement { return Requirement{Any: parts} })
+}
+
+// parseList() reads operands joined by 'op', flattening nested lists of the
+// same operator
+func (p *parser) parseList(op tokenKind, operand func() *Requirement, build func([]Requirement) Requirement) *Requirement {
+	var parts []Requirement
+	for {
+		switch r := operand(); {
+		case r == nil:
+		case op == tokenAnd && len(r.All) > 0:
+			parts = append(parts, r.All...)
+		case op == tokenOr && len(r.Any) > 0:
+			parts = append(parts, r.Any...)
+		default:
+			parts = append(parts, *r)
+		}
+
+		t, ok := p.peek()
+		if !ok || t.kind != op {
+			break
+		}
+		p.pos++
+	}
+	switch len(parts) {
+	case 0:
+		return nil
+	case 1:
+		return &parts[0]
+	}
+	r := build(parts)
+	return &r
+}
+
+func (p *parser) parseAtom() *Requirement {
+	t, ok := p.peek()
+	if !ok {
+		return nil
+	}
+	switch t.kind {
+	case tokenCourse:
+		p.pos++
+		return &Requirement{Course: t.course}
+	case tokenPermission:
+		p.pos++
+		return &Requirement{Permission: true}
+	case tokenOpen:
+		p.pos++
+		r := p.parseAnd()
+		if t, ok := p.peek(); ok && t.kind == tokenClose {
+			p.pos++
+		}
+		return r
+	}
+	return nil // an operator missing its left operand, left for the caller
+}
@@ -0,0 +1,73 @@
+package requisites
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]string{
+		"COMS W3134":                                          "COMS3134",
+		"COMS W3134 and W3157":                                "COMS3134 AND COMS3157",
+		"COMS W3134 or W3137":                                 "COMS3134 OR COMS3137",
+		"COMS W3134 or W3137 and COMS W3203":                  "(COMS3134 OR COMS3137) AND COMS3203",
+		"COMS W3134 and W3157 or the instructor's permission": "(COMS3134 AND COMS3157) OR permission",
+		"COMS W3134, W3137, or W3139":                         "COMS3134 OR COMS3137 OR COMS3139",
+		"MATH V1101, V1102, and V1201":                        "MATH1101 AND MATH1102 AND MATH1201",
+		"COMS W3134 or W3137, and COMS W3203":                 "(COMS3134 OR COMS3137) AND COMS3203",
+		"(COMS W3134 and W3157) or (COMS W3137 and W3157)":    "(COMS3134 AND COMS3157) OR (COMS3137 AND COMS3157)",
+		"COMSW3134; MATH 1201":                                "COMS3134 AND MATH1201",
+		"ECON W1105 or permission of the instructor":          "ECON1105 OR permission",
+		"COMS W3134 or W3137 or the instructor’s permission":  "COMS3134 OR COMS3137 OR permission",
+		"the instructor's permission":                         "permission",
+		"COMS W3134) and W3157 (or equivalent":                "COMS3134 AND COMS3157",
+		"ECON BC3035 and ECON BC3033":                         "ECON3035 AND ECON3033",
+		"ECON BC3035 and BC3033":                              "ECON3035 AND ECON3033",
+		"ECONBC3035 or MATH UN1101":                           "ECON3035 OR MATH1101",
+		"PHYS 1401 or 1601":                                   "PHYS1401 OR PHYS1601",
+		"PHYS 1401 OR 1601":                                   "PHYS1401 OR PHYS1601",
+		"PHYS 1401, 1601, or 2801":                            "PHYS1401 OR PHYS1601 OR PHYS2801",
+		"MATH 1101 taken after 2010":                          "MATH1101",
+		"EE E3082 or EE 3083":                                 "EE3082 OR EE3083",
+	}
+	for text, expected := range cases {
+		r := Parse(text)
+		if r == nil {
+			t.Errorf("Expected %q to parse as %s, found nothing", text, expected)
+		} else if r.String() != expected {
+			t.Errorf("Expected %q to parse as %s, found %s", text, expected, r)
+		}
+	}
+
+	for _, text := range []string{"", "two years of calculus or the equivalent", "taken in Fall 2014"} {
+		if r := Parse(text); r != nil {
+			t.Errorf("Expected no requirement in %q, found %s", text, r)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	r := Extract("An introduction to operating systems. Prerequisites: COMS W3157 and W3827, or the instructor's permission. Cross-listed with CSEE W4119 and CSEE W4119.")
+	if r.Text != "COMS W3157 and W3827, or the instructor's permission" {
+		t.Errorf("Expected the prerequisite sentence, found %q", r.Text)
+	}
+	if r.Prerequisites == nil || r.Prerequisites.String() != "(COMS3157 AND COMS3827) OR permission" {
+		t.Errorf("Expected the prerequisites to be parsed, found %v", r.Prerequisites)
+	}
+	if strings.Join(r.Prerequisites.Courses(), ",") != "COMS3157,COMS3827" {
+		t.Errorf("Expected the prerequisite courses, found %v", r.Prerequisites.Courses())
+	}
+	if strings.Join(r.CrossListings, ",") != "CSEE4119" {
+		t.Errorf("Expected the cross-listing once, found %v", r.CrossListings)
+	}
+
+	r = Extract("Prerequisite(s): MATH V1102. Same as STAT W4105.")
+	if r.Prerequisites == nil || r.Prerequisites.String() != "MATH1102" || strings.Join(r.CrossListings, ",") != "STAT4105" {
+		t.Errorf("Expected MATH1102 cross-listed as STAT4105, found %v and %v", r.Prerequisites, r.CrossListings)
+	}
+
+	r = Extract("This course is a workshop in communication techniques.")
+	if r.Text != "" || r.Prerequisites != nil || r.CrossListings != nil {
+		t.Errorf("Expected nothing from a description without requisites, found %+v", r)
+	}
+}
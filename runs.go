@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/natebrennand/pg_array"
+)
+
+// statuses of a row in 'load_runs'
+const (
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+	runSkipped   = "skipped" // the input matched the last successful run
+)
+
+// tables counted, for the terms covered, at the end of each load
+var runCountTables = []string{
+	"courses_t",
+	"course_terms_t",
+	"sections_v2_t",
+	"section_meetings_t",
+	"section_instructors_t",
+}
+
+// loadRun is a single load, as recorded in 'load_runs'
+type loadRun struct {
+	ID        int64
+	StartedAt time.Time
+	EndedAt   *time.Time
+	Filename  string
+	Checksum  string // SHA-256 of the input, in hex
+	Terms     []string
+	Counts    map[string]int64 // rows by table
+	ESIndex   string
+	Status    string
+	Error     string
+}
+
+// fileChecksum() is the hex SHA-256 of the file's contents
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("Failed to open file, %s, with error: %s", filename, err.Error())
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("Failed to read %s => %s", filename, err.Error())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// nullString() stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// start() inserts the run, setting its ID
+func (r *loadRun) start(ctx context.Context, db *sql.DB) error {
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO load_runs (started_at, filename, checksum, es_index, status)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		r.StartedAt,
+		nullString(r.Filename),
+		nullString(r.Checksum),
+		nullString(r.ESIndex),
+		r.Status,
+	).Scan(&r.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to record load run => %s", err.Error())
+	}
+	return nil
+}
+
+// finish() records how the run ended, counting the rows of each table for the
+// terms it covered
+func (r *loadRun) finish(ctx context.Context, db *sql.DB, now time.Time, loadErr error) error {
+	r.EndedAt = &now
+	if r.Status == runRunning {
+		r.Status = runSucceeded
+	}
+	if loadErr != nil {
+		r.Status = runFailed
+		r.Error = loadErr.Error()
+	}
+
+	if len(r.Terms) > 0 {
+		counts, err := countTermRows(ctx, db, r.Terms, r.StartedAt)
+		if err != nil { // still record the status
+			slog.Warn("failed to count load run rows", "run", r.ID, "err", err.Error())
+		}
+		r.Counts = counts
+	}
+	counts, err := json.Marshal(r.Counts)
+	if err != nil {
+		return fmt.Errorf("Failed to encode load run counts => %s", err.Error())
+	}
+
+	_, err = db.ExecContext(ctx,
+		`UPDATE load_runs SET ended_at = $2, terms = $3::text[], counts = $4, status = $5, error = $6
+		 WHERE id = $1`,
+		r.ID,
+		now,
+		pgTextArray(r.Terms),
+		string(counts),
+		r.Status,
+		nullString(r.Error),
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to record end of load run %d => %s", r.ID, err.Error())
+	}
+	return nil
+}
+
+// countTermRows() counts the rows of each table in the terms, and the change
+// events recorded since the run started
+func countTermRows(ctx context.Context, db *sql.DB, terms []string, since time.Time) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, table := range runCountTables {
+		var n int64
+		err := db.QueryRowContext(ctx,
+			fmt.Sprintf(`SELECT count(*) FROM %s WHERE term = ANY($1::text[])`, table),
+			pgTextArray(terms),
+		).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to count rows of %s => %s", table, err.Error())
+		}
+		counts[table] = n
+	}
+
+	var n int64
+	err := db.QueryRowContext(ctx,
+		`SELECT count(*) FROM change_events_t WHERE created_at >= $1`, since,
+	).Scan(&n)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to count rows of change_events_t => %s", err.Error())
+	}
+	counts["change_events_t"] = n
+	return counts, nil
+}
+
+// lastSuccessfulChecksum() is the input checksum of the last successful load,
+// or empty if there has not been one. With 'withES' only loads that also
+// rebuilt the ES index count, so a -skip-es load does not skip the next load
+// that needs the index.
+func lastSuccessfulChecksum(ctx context.Context, db *sql.DB, withES bool) (string, error) {
+	var checksum string
+	err := db.QueryRowContext(ctx,
+		`SELECT checksum FROM load_runs
+		 WHERE status = 'succeeded' AND checksum IS NOT NULL AND (es_index IS NOT NULL OR NOT $1)
+		 ORDER BY started_at DESC LIMIT 1`,
+		withES,
+	).Scan(&checksum)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("Failed to find the last successful load => %s", err.Error())
+	}
+	return checksum, nil
+}
+
+// queryLoadRuns() lists the most recent runs first
+func queryLoadRuns(ctx context.Context, db *sql.DB, limit int) ([]loadRun, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, started_at, ended_at, coalesce(filename, ''), coalesce(checksum, ''), terms,
+		 counts, coalesce(es_index, ''), status, coalesce(error, '')
+		 FROM load_runs ORDER BY started_at DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query load runs => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var runs []loadRun
+	for rows.Next() {
+		var r loadRun
+		var ended sql.NullTime
+		var terms pgarray.SqlStringArray
+		var counts []byte
+		err := rows.Scan(&r.ID, &r.StartedAt, &ended, &r.Filename, &r.Checksum, &terms,
+			&counts, &r.ESIndex, &r.Status, &r.Error)
+		if err != nil {
+			return nil, fmt.Errorf("Error while processing load runs => %s", err.Error())
+		}
+		if ended.Valid {
+			r.EndedAt = &ended.Time
+		}
+		r.Terms = terms.Data
+		if len(counts) > 0 {
+			if err := json.Unmarshal(counts, &r.Counts); err != nil {
+				return nil, fmt.Errorf("Failed to decode counts of load run %d => %s", r.ID, err.Error())
+			}
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// writeHistory() prints the runs as a table
+func writeHistory(out io.Writer, runs []loadRun) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tDURATION\tSTATUS\tTERMS\tSECTIONS\tFILE\tCHECKSUM\tES INDEX")
+	for _, r := range runs {
+		duration := "-"
+		if r.EndedAt != nil {
+			duration = r.EndedAt.Sub(r.StartedAt).Round(time.Second).String()
+		}
+		checksum := r.Checksum
+		if len(checksum) > 12 {
+			checksum = checksum[:12]
+		}
+		status := r.Status
+		if r.Error != "" {
+			status += ": " + r.Error
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			r.ID,
+			r.StartedAt.Local().Format("2006-01-02 15:04"),
+			duration,
+			status,
+			strings.Join(r.Terms, ","),
+			r.Counts["sections_v2_t"],
+			r.Filename,
+			checksum,
+			r.ESIndex,
+		)
+	}
+	return w.Flush()
+}
+
+// historyCmd() lists past loads
+func historyCmd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := flags.Int("limit", 20, "Number of runs to list")
+	asJSON := flags.Bool("json", false, "Print the runs as JSON")
+	flags.Parse(args)
+
+	db := connectPG()
+	defer db.Close()
+
+	runs, err := queryLoadRuns(ctx, db, *limit)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(runs)
+	}
+	return writeHistory(os.Stdout, runs)
+}
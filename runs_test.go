@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFileChecksum(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "doc.json")
+	if err := os.WriteFile(filename, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := fileChecksum(filename)
+	if err != nil {
+		t.Fatalf("Failed to checksum file => %s", err.Error())
+	}
+	expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if sum != expected {
+		t.Errorf("Expected the SHA-256 of the file, %s, found %s", expected, sum)
+	}
+
+	if _, err := fileChecksum(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestWriteHistory(t *testing.T) {
+	ended := testStarted.Add(90 * time.Second)
+	runs := []loadRun{
+		{
+			ID:        2,
+			StartedAt: testStarted,
+			EndedAt:   &ended,
+			Filename:  "doc.json",
+			Checksum:  "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+			Terms:     []string{"20143", "20151"},
+			Counts:    map[string]int64{"sections_v2_t": 4521},
+			ESIndex:   "courses",
+			Status:    runSucceeded,
+		},
+		{ID: 1, StartedAt: testStarted, Status: runFailed, Error: "failed to load courses"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHistory(&buf, runs); err != nil {
+		t.Fatalf("Failed to write history => %s", err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 runs, found %q", buf.String())
+	}
+	for _, s := range []string{"1m30s", "succeeded", "20143,20151", "4521", "ba7816bf8f01 ", "courses"} {
+		if !strings.Contains(lines[1], s) {
+			t.Errorf("Expected %q in the first run, found %q", s, lines[1])
+		}
+	}
+	if !strings.Contains(lines[2], "failed: failed to load courses") {
+		t.Errorf("Expected the failed run's error, found %q", lines[2])
+	}
+}
+
+func TestLastSuccessfulChecksum(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a load that needs ES only matches loads that rebuilt the index
+	query := `WHERE status = 'succeeded' AND checksum IS NOT NULL AND \(es_index IS NOT NULL OR NOT \$1\)`
+	mock.ExpectQuery(query).WithArgs(true).WillReturnRows(sqlmock.NewRows([]string{"checksum"}))
+	mock.ExpectQuery(query).WithArgs(false).WillReturnRows(sqlmock.NewRows([]string{"checksum"}).AddRow("abc"))
+
+	if sum, err := lastSuccessfulChecksum(context.Background(), db, true); err != nil || sum != "" {
+		t.Errorf("Expected no checksum without a load that rebuilt ES, found %q, %v", sum, err)
+	}
+	if sum, err := lastSuccessfulChecksum(context.Background(), db, false); err != nil || sum != "abc" {
+		t.Errorf("Expected the last load's checksum, found %q, %v", sum, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
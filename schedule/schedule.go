@@ -0,0 +1,169 @@
+// Package schedule finds time and exam conflicts between course sections and
+// enumerates the conflict-free ways to take a list of courses.
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Kinds of Conflict
+const (
+	TimeConflict = "time"
+	ExamConflict = "exam"
+)
+
+// Clock is a time of day in minutes after midnight
+type Clock int
+
+// ParseClock reads a time of day such as "14:10" or "14:10:00"
+func ParseClock(s string) (Clock, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return Clock(t.Hour()*60 + t.Minute()), nil
+		}
+	}
+	return 0, fmt.Errorf("could not parse time of day, %s", s)
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", c/60, c%60)
+}
+
+// Meeting is a weekly meeting of a section
+type Meeting struct {
+	Weekdays []time.Weekday
+	Start    Clock
+	End      Clock
+}
+
+// Exam is a section's final exam. A zero Start and End means the time is not known.
+type Exam struct {
+	Date  time.Time
+	Start Clock
+	End   Clock
+}
+
+// Section is a single section a student could register for
+type Section struct {
+	CallNumber string
+	Course     string
+	Meetings   []Meeting
+	Exam       *Exam
+}
+
+// Conflict is a clash between two sections
+type Conflict struct {
+	Kind string
+	A, B string // call numbers
+	Day  time.Weekday
+	Date time.Time // for exam conflicts
+}
+
+func overlaps(aStart, aEnd, bStart, bEnd Clock) bool {
+	return aStart < bEnd && bStart < aEnd
+}
+
+// timeConflicts lists the weekdays the two sections meet at the same time
+func timeConflicts(a, b Section) []time.Weekday {
+	clash := make(map[time.Weekday]bool)
+	for _, am := range a.Meetings {
+		for _, bm := range b.Meetings {
+			if !overlaps(am.Start, am.End, bm.Start, bm.End) {
+				continue
+			}
+			for _, ad := range am.Weekdays {
+				for _, bd := range bm.Weekdays {
+					if ad == bd {
+						clash[ad] = true
+					}
+				}
+			}
+		}
+	}
+
+	var days []time.Weekday
+	for d := range clash {
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+	return days
+}
+
+// examConflict is whether the two exams are on the same day and overlap, or
+// are on the same day and either time is not known
+func examConflict(a, b Section) bool {
+	if a.Exam == nil || b.Exam == nil || a.Exam.Date.IsZero() || !sameDate(a.Exam.Date, b.Exam.Date) {
+		return false
+	}
+	if a.Exam.End == 0 || b.Exam.End == 0 {
+		return true
+	}
+	return overlaps(a.Exam.Start, a.Exam.End, b.Exam.Start, b.Exam.End)
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Pair lists every conflict between two sections
+func Pair(a, b Section) []Conflict {
+	var conflicts []Conflict
+	for _, day := range timeConflicts(a, b) {
+		conflicts = append(conflicts, Conflict{Kind: TimeConflict, A: a.CallNumber, B: b.CallNumber, Day: day})
+	}
+	if examConflict(a, b) {
+		conflicts = append(conflicts, Conflict{Kind: ExamConflict, A: a.CallNumber, B: b.CallNumber, Date: a.Exam.Date})
+	}
+	return conflicts
+}
+
+// Conflicts lists the pairwise conflicts between all of the sections
+func Conflicts(sections []Section) []Conflict {
+	var conflicts []Conflict
+	for i := range sections {
+		for j := i + 1; j < len(sections); j++ {
+			conflicts = append(conflicts, Pair(sections[i], sections[j])...)
+		}
+	}
+	return conflicts
+}
+
+// Combinations enumerates the ways to take one section of each course in
+// 'options' with no time or exam conflicts, stopping after 'limit' schedules
+// when 'limit' is positive. Courses are tried in the given order.
+func Combinations(options [][]Section, limit int) [][]Section {
+	var (
+		results [][]Section
+		chosen  = make([]Section, 0, len(options))
+		search  func(course int)
+	)
+	search = func(course int) {
+		if limit > 0 && len(results) >= limit {
+			return
+		}
+		if course == len(options) {
+			results = append(results, append([]Section(nil), chosen...))
+			return
+		}
+		for _, s := range options[course] {
+			clash := false
+			for _, c := range chosen {
+				if len(Pair(c, s)) > 0 {
+					clash = true
+					break
+				}
+			}
+			if !clash {
+				chosen = append(chosen, s)
+				search(course + 1)
+				chosen = chosen[:len(chosen)-1]
+			}
+		}
+	}
+	search(0)
+	return results
+}
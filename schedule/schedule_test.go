@@ -0,0 +1,89 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func clock(s string) Clock {
+	c, err := ParseClock(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func meeting(start, end string, days ...time.Weekday) Meeting {
+	return Meeting{Weekdays: days, Start: clock(start), End: clock(end)}
+}
+
+var (
+	examDay = time.Date(2014, time.December, 15, 0, 0, 0, 0, time.UTC)
+
+	// fixture sections, "TR 10:10-11:25" and the like
+	os1 = Section{CallNumber: "1", Course: "COMS4118", Meetings: []Meeting{meeting("10:10", "11:25", time.Tuesday, time.Thursday)},
+		Exam: &Exam{Date: examDay, Start: clock("09:00"), End: clock("12:00")}}
+	os2 = Section{CallNumber: "2", Course: "COMS4118", Meetings: []Meeting{meeting("16:10", "17:25", time.Monday, time.Wednesday)}}
+	db1 = Section{CallNumber: "3", Course: "COMS4111", Meetings: []Meeting{meeting("11:00", "12:15", time.Tuesday)},
+		Exam: &Exam{Date: examDay, Start: clock("13:10"), End: clock("16:00")}}
+	db2 = Section{CallNumber: "4", Course: "COMS4111", Meetings: []Meeting{meeting("11:25", "12:40", time.Tuesday, time.Thursday)}}
+	ml1 = Section{CallNumber: "5", Course: "COMS4771", Meetings: []Meeting{meeting("16:10", "17:25", time.Wednesday)},
+		Exam: &Exam{Date: examDay, Start: clock("10:00"), End: clock("13:00")}}
+)
+
+func TestConflicts(t *testing.T) {
+	conflicts := Conflicts([]Section{os1, db1, db2, ml1})
+	expected := map[Conflict]bool{
+		{Kind: TimeConflict, A: "1", B: "3", Day: time.Tuesday}: true, // 10:10-11:25 vs 11:00-12:15
+		{Kind: ExamConflict, A: "1", B: "5", Date: examDay}:     true, // 9-12 vs 10-1
+		{Kind: TimeConflict, A: "3", B: "4", Day: time.Tuesday}: true,
+	}
+	if len(conflicts) != len(expected) {
+		t.Errorf("Expected %d conflicts, found %#v", len(expected), conflicts)
+	}
+	for _, c := range conflicts {
+		if !expected[c] {
+			t.Errorf("Unexpected conflict, %#v", c)
+		}
+	}
+
+	// back to back classes do not conflict
+	if c := Pair(os1, db2); len(c) != 0 {
+		t.Errorf("Expected sections that only touch not to conflict, found %#v", c)
+	}
+}
+
+func TestExamWithoutTime(t *testing.T) {
+	a := Section{CallNumber: "1", Exam: &Exam{Date: examDay}}
+	b := Section{CallNumber: "2", Exam: &Exam{Date: examDay.Add(3 * time.Hour), Start: clock("09:00"), End: clock("12:00")}}
+	if c := Pair(a, b); len(c) != 1 || c[0].Kind != ExamConflict {
+		t.Errorf("Expected exams on the same day with an unknown time to conflict, found %#v", c)
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	options := [][]Section{{os1, os2}, {db1, db2}, {ml1}}
+	combos := Combinations(options, 0)
+
+	// os1 clashes with db1 (time) and ml1 (exam), os2 clashes with ml1 (time)
+	if len(combos) != 0 {
+		t.Errorf("Expected no conflict-free schedules, found %#v", combos)
+	}
+
+	combos = Combinations(options[:2], 0)
+	expected := [][]string{{"1", "4"}, {"2", "3"}, {"2", "4"}}
+	if len(combos) != len(expected) {
+		t.Fatalf("Expected %d schedules, found %#v", len(expected), combos)
+	}
+	for i, combo := range combos {
+		for j, s := range combo {
+			if s.CallNumber != expected[i][j] {
+				t.Errorf("Expected schedule %v, found %#v", expected[i], combo)
+			}
+		}
+	}
+
+	if combos := Combinations(options[:2], 1); len(combos) != 1 {
+		t.Errorf("Expected the limit to stop the search, found %d schedules", len(combos))
+	}
+}
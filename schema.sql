@@ -34,8 +34,11 @@ SET default_with_oids = false;
 --
 
 CREATE TABLE courses_add_info (
-    coursefull character varying(32),
-    globalcore boolean
+    coursefull character varying(32) NOT NULL,
+    globalcore boolean,
+    corecurriculum boolean,
+    writingintensive boolean,
+    labscience boolean
 );
 
 
@@ -157,12 +160,94 @@ CREATE TABLE courses_v2_t (
     bulletinflags character varying(32),
     classnotes character varying(64),
     prefixlongname character varying(32),
-    description text
+    description text,
+    term character varying(32)
 );
 
 
 ALTER TABLE public.courses_v2_t OWNER TO adicu;
 
+--
+-- Name: change_events_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE change_events_t (
+    id bigserial NOT NULL,
+    kind character varying(32) NOT NULL,
+    term character varying(32) NOT NULL,
+    callnumber integer NOT NULL,
+    course character varying(32),
+    old text,
+    new text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    delivered_at timestamp with time zone
+);
+
+
+ALTER TABLE public.change_events_t OWNER TO adicu;
+
+--
+-- Name: course_terms_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE course_terms_t (
+    course character varying(32) NOT NULL,
+    term character varying(32) NOT NULL,
+    coursefull character varying(32),
+    prefixname character varying(32),
+    divisioncode character varying(32),
+    divisionname character varying(64),
+    schoolcode character varying(32),
+    schoolname character varying(64),
+    departmentcode character varying(32),
+    departmentname character varying(64),
+    subtermcode character varying(32),
+    subtermname character varying(64),
+    enrollmentstatus character varying(32),
+    numfixedunits integer,
+    minunits integer,
+    maxunits integer,
+    coursetitle character varying(64),
+    coursesubtitle character varying(64),
+    approval character varying(32),
+    bulletinflags character varying(32),
+    classnotes character varying(64),
+    prefixlongname character varying(32),
+    description text
+);
+
+
+ALTER TABLE public.course_terms_t OWNER TO adicu;
+
+--
+-- Name: cross_listings_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE cross_listings_t (
+    course character varying(32) NOT NULL,
+    crosslisted character varying(32) NOT NULL
+);
+
+
+ALTER TABLE public.cross_listings_t OWNER TO adicu;
+
+--
+-- Name: enrollment_snapshots_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE enrollment_snapshots_t (
+    term character varying(32) NOT NULL,
+    callnumber integer NOT NULL,
+    course character varying(32),
+    numenrolled integer,
+    maxsize integer,
+    enrollmentstatus character varying(32),
+    observed_at timestamp with time zone NOT NULL
+);
+
+
+ALTER TABLE public.enrollment_snapshots_t OWNER TO adicu;
+
 --
 -- Name: housing_amenities_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
 --
@@ -208,6 +293,103 @@ CREATE TABLE housing_t (
 
 ALTER TABLE public.housing_t OWNER TO adicu;
 
+--
+-- Name: instructors_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE instructors_t (
+    id serial NOT NULL,
+    name character varying(64) NOT NULL,
+    canonical character varying(64) NOT NULL,
+    lastname character varying(64) NOT NULL
+);
+
+
+ALTER TABLE public.instructors_t OWNER TO adicu;
+
+--
+-- Name: load_runs; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE load_runs (
+    id bigserial NOT NULL,
+    started_at timestamp with time zone NOT NULL,
+    ended_at timestamp with time zone,
+    filename character varying(256),
+    checksum character(64),
+    terms character varying(32)[],
+    counts jsonb,
+    es_index character varying(64),
+    status character varying(16) NOT NULL,
+    error text
+);
+
+
+ALTER TABLE public.load_runs OWNER TO adicu;
+
+--
+-- Name: prerequisites_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE prerequisites_t (
+    course character varying(32) NOT NULL,
+    text text NOT NULL,
+    expression jsonb
+);
+
+
+ALTER TABLE public.prerequisites_t OWNER TO adicu;
+
+--
+-- Name: room_occupancy_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE room_occupancy_t (
+    term character varying(32) NOT NULL,
+    building character varying(32) NOT NULL,
+    room character varying(32) NOT NULL,
+    weekday character(1) NOT NULL,
+    starttime time without time zone,
+    endtime time without time zone,
+    callnumber integer,
+    course character varying(32)
+);
+
+
+ALTER TABLE public.room_occupancy_t OWNER TO adicu;
+
+--
+-- Name: section_instructors_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE section_instructors_t (
+    term character varying(32) NOT NULL,
+    callnumber integer NOT NULL,
+    instructor_id integer NOT NULL,
+    "position" smallint NOT NULL
+);
+
+
+ALTER TABLE public.section_instructors_t OWNER TO adicu;
+
+--
+-- Name: section_meetings_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE TABLE section_meetings_t (
+    term character varying(32) NOT NULL,
+    callnumber integer NOT NULL,
+    slot smallint NOT NULL,
+    weekday character(1) NOT NULL,
+    starttime time without time zone,
+    endtime time without time zone,
+    building character varying(32),
+    room character varying(32)
+);
+
+
+ALTER TABLE public.section_meetings_t OWNER TO adicu;
+
 --
 -- Name: sections_v2_t; Type: TABLE; Schema: public; Owner: adicu; Tablespace: 
 --
@@ -270,7 +452,9 @@ CREATE TABLE sections_v2_t (
     instructor3name character varying(32),
     instructor4name character varying(32),
     campuscode character varying(32),
-    campusname character varying(32)
+    campusname character varying(32),
+    enrollmentstatus character varying(32),
+    cancelled_at timestamp with time zone
 );
 
 
@@ -282,8 +466,9 @@ ALTER TABLE public.sections_v2_t OWNER TO adicu;
 
 CREATE TABLE users_t (
     email character varying(64) NOT NULL,
-    token character varying(32) NOT NULL,
-    name character varying(64) NOT NULL
+    token character varying(32),
+    name character varying(64) NOT NULL,
+    token_hashed boolean DEFAULT false NOT NULL
 );
 
 
@@ -297,6 +482,110 @@ ALTER TABLE ONLY courses_v2_t
     ADD CONSTRAINT courses_v2_t_pkey PRIMARY KEY (course);
 
 
+--
+-- Name: change_events_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY change_events_t
+    ADD CONSTRAINT change_events_t_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: courses_add_info_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY courses_add_info
+    ADD CONSTRAINT courses_add_info_pkey PRIMARY KEY (coursefull);
+
+
+--
+-- Name: course_terms_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY course_terms_t
+    ADD CONSTRAINT course_terms_t_pkey PRIMARY KEY (course, term);
+
+
+--
+-- Name: cross_listings_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY cross_listings_t
+    ADD CONSTRAINT cross_listings_t_pkey PRIMARY KEY (course, crosslisted);
+
+
+--
+-- Name: housing_amenities_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY housing_amenities_t
+    ADD CONSTRAINT housing_amenities_t_pkey PRIMARY KEY (building);
+
+
+--
+-- Name: housing_t_roomlocation_room_key; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY housing_t
+    ADD CONSTRAINT housing_t_roomlocation_room_key UNIQUE (roomlocation, room);
+
+
+--
+-- Name: instructors_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY instructors_t
+    ADD CONSTRAINT instructors_t_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: instructors_t_canonical_key; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY instructors_t
+    ADD CONSTRAINT instructors_t_canonical_key UNIQUE (canonical);
+
+
+--
+-- Name: load_runs_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY load_runs
+    ADD CONSTRAINT load_runs_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: prerequisites_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY prerequisites_t
+    ADD CONSTRAINT prerequisites_t_pkey PRIMARY KEY (course);
+
+
+--
+-- Name: section_instructors_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY section_instructors_t
+    ADD CONSTRAINT section_instructors_t_pkey PRIMARY KEY (term, callnumber, instructor_id);
+
+
+--
+-- Name: section_meetings_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY section_meetings_t
+    ADD CONSTRAINT section_meetings_t_pkey PRIMARY KEY (term, callnumber, slot, weekday);
+
+
+--
+-- Name: sections_v2_t_pkey; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
+--
+
+ALTER TABLE ONLY sections_v2_t
+    ADD CONSTRAINT sections_v2_t_pkey PRIMARY KEY (term, callnumber);
+
+
 --
 -- Name: users_t_email_key; Type: CONSTRAINT; Schema: public; Owner: adicu; Tablespace: 
 --
@@ -305,6 +594,72 @@ ALTER TABLE ONLY users_t
     ADD CONSTRAINT users_t_email_key UNIQUE (email);
 
 
+--
+-- Name: change_events_t_pending_idx; Type: INDEX; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE INDEX change_events_t_pending_idx ON change_events_t USING btree (id) WHERE (delivered_at IS NULL);
+
+
+--
+-- Name: enrollment_snapshots_t_term_idx; Type: INDEX; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE INDEX enrollment_snapshots_t_term_idx ON enrollment_snapshots_t USING btree (term, callnumber, observed_at);
+
+
+--
+-- Name: instructors_t_lastname_idx; Type: INDEX; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE INDEX instructors_t_lastname_idx ON instructors_t USING btree ("left"((lastname)::text, 3));
+
+
+--
+-- Name: load_runs_succeeded_idx; Type: INDEX; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE INDEX load_runs_succeeded_idx ON load_runs USING btree (started_at) WHERE ((status)::text = 'succeeded'::text);
+
+
+--
+-- Name: section_instructors_t_instructor_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
+--
+
+ALTER TABLE ONLY section_instructors_t
+    ADD CONSTRAINT section_instructors_t_instructor_fkey FOREIGN KEY (instructor_id) REFERENCES instructors_t(id);
+
+
+--
+-- Name: section_instructors_t_section_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
+--
+
+ALTER TABLE ONLY section_instructors_t
+    ADD CONSTRAINT section_instructors_t_section_fkey FOREIGN KEY (term, callnumber) REFERENCES sections_v2_t(term, callnumber);
+
+
+--
+-- Name: room_occupancy_t_room_idx; Type: INDEX; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE INDEX room_occupancy_t_room_idx ON room_occupancy_t USING btree (term, building, room, weekday);
+
+
+--
+-- Name: section_meetings_t_room_idx; Type: INDEX; Schema: public; Owner: adicu; Tablespace: 
+--
+
+CREATE INDEX section_meetings_t_room_idx ON section_meetings_t USING btree (term, building, room, weekday);
+
+
+--
+-- Name: section_meetings_t_section_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
+--
+
+ALTER TABLE ONLY section_meetings_t
+    ADD CONSTRAINT section_meetings_t_section_fkey FOREIGN KEY (term, callnumber) REFERENCES sections_v2_t(term, callnumber);
+
+
 --
 -- Name: sections_v2_t_course_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
 --
@@ -313,6 +668,30 @@ ALTER TABLE ONLY sections_v2_t
     ADD CONSTRAINT sections_v2_t_course_fkey FOREIGN KEY (course) REFERENCES courses_v2_t(course);
 
 
+--
+-- Name: course_terms_t_course_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
+--
+
+ALTER TABLE ONLY course_terms_t
+    ADD CONSTRAINT course_terms_t_course_fkey FOREIGN KEY (course) REFERENCES courses_v2_t(course);
+
+
+--
+-- Name: cross_listings_t_course_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
+--
+
+ALTER TABLE ONLY cross_listings_t
+    ADD CONSTRAINT cross_listings_t_course_fkey FOREIGN KEY (course) REFERENCES courses_v2_t(course);
+
+
+--
+-- Name: prerequisites_t_course_fkey; Type: FK CONSTRAINT; Schema: public; Owner: adicu
+--
+
+ALTER TABLE ONLY prerequisites_t
+    ADD CONSTRAINT prerequisites_t_course_fkey FOREIGN KEY (course) REFERENCES courses_v2_t(course);
+
+
 --
 -- Name: public; Type: ACL; Schema: -; Owner: postgres
 --
@@ -353,6 +732,46 @@ GRANT ALL ON TABLE courses_v2_t TO adicu;
 GRANT SELECT ON TABLE courses_v2_t TO adicu2;
 
 
+--
+-- Name: change_events_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE change_events_t FROM PUBLIC;
+REVOKE ALL ON TABLE change_events_t FROM adicu;
+GRANT ALL ON TABLE change_events_t TO adicu;
+GRANT SELECT ON TABLE change_events_t TO adicu2;
+
+
+--
+-- Name: course_terms_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE course_terms_t FROM PUBLIC;
+REVOKE ALL ON TABLE course_terms_t FROM adicu;
+GRANT ALL ON TABLE course_terms_t TO adicu;
+GRANT SELECT ON TABLE course_terms_t TO adicu2;
+
+
+--
+-- Name: cross_listings_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE cross_listings_t FROM PUBLIC;
+REVOKE ALL ON TABLE cross_listings_t FROM adicu;
+GRANT ALL ON TABLE cross_listings_t TO adicu;
+GRANT SELECT ON TABLE cross_listings_t TO adicu2;
+
+
+--
+-- Name: enrollment_snapshots_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE enrollment_snapshots_t FROM PUBLIC;
+REVOKE ALL ON TABLE enrollment_snapshots_t FROM adicu;
+GRANT ALL ON TABLE enrollment_snapshots_t TO adicu;
+GRANT SELECT ON TABLE enrollment_snapshots_t TO adicu2;
+
+
 --
 -- Name: housing_amenities_t; Type: ACL; Schema: public; Owner: adicu
 --
@@ -373,6 +792,66 @@ GRANT ALL ON TABLE housing_t TO adicu;
 GRANT SELECT ON TABLE housing_t TO adicu2;
 
 
+--
+-- Name: instructors_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE instructors_t FROM PUBLIC;
+REVOKE ALL ON TABLE instructors_t FROM adicu;
+GRANT ALL ON TABLE instructors_t TO adicu;
+GRANT SELECT ON TABLE instructors_t TO adicu2;
+
+
+--
+-- Name: load_runs; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE load_runs FROM PUBLIC;
+REVOKE ALL ON TABLE load_runs FROM adicu;
+GRANT ALL ON TABLE load_runs TO adicu;
+GRANT SELECT ON TABLE load_runs TO adicu2;
+
+
+--
+-- Name: prerequisites_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE prerequisites_t FROM PUBLIC;
+REVOKE ALL ON TABLE prerequisites_t FROM adicu;
+GRANT ALL ON TABLE prerequisites_t TO adicu;
+GRANT SELECT ON TABLE prerequisites_t TO adicu2;
+
+
+--
+-- Name: room_occupancy_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE room_occupancy_t FROM PUBLIC;
+REVOKE ALL ON TABLE room_occupancy_t FROM adicu;
+GRANT ALL ON TABLE room_occupancy_t TO adicu;
+GRANT SELECT ON TABLE room_occupancy_t TO adicu2;
+
+
+--
+-- Name: section_instructors_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE section_instructors_t FROM PUBLIC;
+REVOKE ALL ON TABLE section_instructors_t FROM adicu;
+GRANT ALL ON TABLE section_instructors_t TO adicu;
+GRANT SELECT ON TABLE section_instructors_t TO adicu2;
+
+
+--
+-- Name: section_meetings_t; Type: ACL; Schema: public; Owner: adicu
+--
+
+REVOKE ALL ON TABLE section_meetings_t FROM PUBLIC;
+REVOKE ALL ON TABLE section_meetings_t FROM adicu;
+GRANT ALL ON TABLE section_meetings_t TO adicu;
+GRANT SELECT ON TABLE section_meetings_t TO adicu2;
+
+
 --
 -- Name: sections_v2_t; Type: ACL; Schema: public; Owner: adicu
 --
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// names of the files within a snapshot archive
+const (
+	snapshotManifestFile  = "manifest.json"
+	snapshotTablesDir     = "tables"
+	snapshotDocumentsFile = "es/documents.ndjson"
+)
+
+// snapshotTable is how a table's rows for a term are exported and restored.
+// Rows are exported as JSON objects, one per line.
+type snapshotTable struct {
+	Name    string
+	Export  string // selects the term's rows, $1 is the term
+	Clear   string // deletes the term's rows before they are restored, if set
+	Restore string // inserts a single exported row, $1 is its JSON
+}
+
+// snapshotTables are in the order they are restored. Instructors are matched
+// on their canonical name since ids differ between databases.
+var snapshotTables = []snapshotTable{
+	{
+		Name:   "courses_v2_t",
+		Export: `SELECT * FROM courses_v2_t WHERE course IN (SELECT course FROM sections_v2_t WHERE term = $1)`,
+		// the stored course is kept if it comes from a later term, as with a load
+		Restore: `INSERT INTO courses_v2_t SELECT * FROM json_populate_record(NULL::courses_v2_t, $1)
+		 ON CONFLICT (course) DO UPDATE SET ` + excludedColumns(coursesTable.valueColumns()) + `
+		 WHERE courses_v2_t.term IS NULL OR courses_v2_t.term <= EXCLUDED.term`,
+	},
+	{
+		Name: "courses_add_info",
+		Export: `SELECT A.* FROM courses_add_info A WHERE A.coursefull IN (
+		 SELECT C.coursefull FROM courses_v2_t C JOIN sections_v2_t S ON S.course = C.course WHERE S.term = $1)`,
+		Restore: `INSERT INTO courses_add_info SELECT * FROM json_populate_record(NULL::courses_add_info, $1)
+		 ON CONFLICT (coursefull) DO UPDATE SET ` + excludedColumns(courseAttributeColumns()),
+	},
+	{
+		Name:    "course_terms_t",
+		Export:  `SELECT * FROM course_terms_t WHERE term = $1`,
+		Clear:   `DELETE FROM course_terms_t WHERE term = $1`,
+		Restore: `INSERT INTO course_terms_t SELECT * FROM json_populate_record(NULL::course_terms_t, $1)`,
+	},
+	{
+		Name:    "courses_t",
+		Export:  `SELECT * FROM courses_t WHERE term = $1`,
+		Clear:   `DELETE FROM courses_t WHERE term = $1`,
+		Restore: `INSERT INTO courses_t SELECT * FROM json_populate_record(NULL::courses_t, $1)`,
+	},
+	{
+		Name:    "sections_v2_t",
+		Export:  `SELECT * FROM sections_v2_t WHERE term = $1`,
+		Clear:   `DELETE FROM sections_v2_t WHERE term = $1`,
+		Restore: `INSERT INTO sections_v2_t SELECT * FROM json_populate_record(NULL::sections_v2_t, $1)`,
+	},
+	{
+		Name:    "section_meetings_t",
+		Export:  `SELECT * FROM section_meetings_t WHERE term = $1`,
+		Clear:   `DELETE FROM section_meetings_t WHERE term = $1`,
+		Restore: `INSERT INTO section_meetings_t SELECT * FROM json_populate_record(NULL::section_meetings_t, $1)`,
+	},
+	{
+		Name: "instructors_t",
+		Export: `SELECT name, canonical, lastname FROM instructors_t
+		 WHERE id IN (SELECT instructor_id FROM section_instructors_t WHERE term = $1)`,
+		Restore: `INSERT INTO instructors_t (name, canonical, lastname)
+		 SELECT name, canonical, lastname FROM json_populate_record(NULL::instructors_t, $1)
+		 ON CONFLICT (canonical) DO NOTHING`,
+	},
+	{
+		Name: "section_instructors_t",
+		Export: `SELECT SI.term, SI.callnumber, SI."position", I.canonical
+		 FROM section_instructors_t SI JOIN instructors_t I ON I.id = SI.instructor_id
+		 WHERE SI.term = $1`,
+		Clear: `DELETE FROM section_instructors_t WHERE term = $1`,
+		Restore: `INSERT INTO section_instructors_t (term, callnumber, instructor_id, "position")
+		 SELECT R.term, R.callnumber, I.id, R."position"
+		 FROM json_to_record($1) AS R(term text, callnumber integer, "position" smallint, canonical text)
+		 JOIN instructors_t I ON I.canonical = R.canonical`,
+	},
+}
+
+func courseAttributeColumns() []string {
+	columns := make([]string, len(courseAttributes))
+	for i, a := range courseAttributes {
+		columns[i] = a.Column
+	}
+	return columns
+}
+
+// snapshotManifest describes the contents of a snapshot archive
+type snapshotManifest struct {
+	Term       string
+	ExportedAt time.Time
+	Rows       map[string]int // by table
+	Documents  int
+}
+
+// termSnapshot is a term's rows and ES documents
+type termSnapshot struct {
+	Manifest  snapshotManifest
+	Tables    map[string][]json.RawMessage
+	Documents []json.RawMessage // as indexed, EX: esData
+}
+
+// exportSnapshot() reads the term's rows and builds its ES documents
+func exportSnapshot(ctx context.Context, db *sql.DB, term string, now time.Time) (*termSnapshot, error) {
+	s := &termSnapshot{
+		Manifest: snapshotManifest{Term: term, ExportedAt: now, Rows: make(map[string]int)},
+		Tables:   make(map[string][]json.RawMessage),
+	}
+	for _, t := range snapshotTables {
+		rows, err := exportTable(ctx, db, t, term)
+		if err != nil {
+			return nil, err
+		}
+		s.Tables[t.Name] = rows
+		s.Manifest.Rows[t.Name] = len(rows)
+	}
+
+	docs, err := exportDocuments(ctx, db, term)
+	if err != nil {
+		return nil, err
+	}
+	s.Documents = docs
+	s.Manifest.Documents = len(docs)
+	return s, nil
+}
+
+func exportTable(ctx context.Context, db *sql.DB, t snapshotTable, term string) ([]json.RawMessage, error) {
+	rows, err := db.QueryContext(ctx, `SELECT row_to_json(R) FROM (`+t.Export+`) R`, term)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to export %s => %s", t.Name, err.Error())
+	}
+	defer rows.Close()
+
+	var exported []json.RawMessage
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return nil, fmt.Errorf("Error while exporting %s => %s", t.Name, err.Error())
+		}
+		exported = append(exported, json.RawMessage(row))
+	}
+	return exported, rows.Err()
+}
+
+// exportDocuments() builds the ES documents of the courses offered in the term
+func exportDocuments(ctx context.Context, db *sql.DB, term string) ([]json.RawMessage, error) {
+	rows, err := db.QueryContext(ctx, `SELECT * FROM (`+esQuery+`) D WHERE $1 = ANY(D.term)`, term)
+	if err != nil {
+		return nil, fmt.Errorf("Error while querying Postgres for ES data => %s", err.Error())
+	}
+	defer rows.Close()
+
+	var docs []json.RawMessage
+	for rows.Next() {
+		data, err := scanEsData(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Error while processing PG data => %s", err.Error())
+		}
+		doc, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode ES document for %s => %s", data.Course, err.Error())
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// write() writes the snapshot as a gzipped tarball holding the manifest, an
+// NDJSON file per table and an NDJSON file of the ES documents
+func (s *termSnapshot) write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(s.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode snapshot manifest => %s", err.Error())
+	}
+	if err := writeTarFile(tw, snapshotManifestFile, s.Manifest.ExportedAt, manifest); err != nil {
+		return err
+	}
+	for _, t := range snapshotTables {
+		name := path.Join(snapshotTablesDir, t.Name+".ndjson")
+		if err := writeTarFile(tw, name, s.Manifest.ExportedAt, ndjson(s.Tables[t.Name])); err != nil {
+			return err
+		}
+	}
+	if err := writeTarFile(tw, snapshotDocumentsFile, s.Manifest.ExportedAt, ndjson(s.Documents)); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("Failed to write snapshot => %s", err.Error())
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("Failed to write snapshot => %s", err.Error())
+	}
+	return nil
+}
+
+func ndjson(lines []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.Write(l)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func writeTarFile(tw *tar.Writer, name string, modTime time.Time, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to write %s to snapshot => %s", name, err.Error())
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("Failed to write %s to snapshot => %s", name, err.Error())
+	}
+	return nil
+}
+
+// readSnapshot() reads a snapshot archive, checking it holds every row its
+// manifest lists
+func readSnapshot(r io.Reader) (*termSnapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read snapshot => %s", err.Error())
+	}
+	defer gz.Close()
+
+	s := &termSnapshot{Tables: make(map[string][]json.RawMessage)}
+	tables := make(map[string]bool)
+	for _, t := range snapshotTables {
+		tables[t.Name] = true
+	}
+
+	foundManifest := false
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to read snapshot => %s", err.Error())
+		}
+
+		switch name := hdr.Name; {
+		case name == snapshotManifestFile:
+			if err := json.NewDecoder(tr).Decode(&s.Manifest); err != nil {
+				return nil, fmt.Errorf("Failed to decode snapshot manifest => %s", err.Error())
+			}
+			foundManifest = true
+		case name == snapshotDocumentsFile:
+			if s.Documents, err = readNDJSON(tr); err != nil {
+				return nil, fmt.Errorf("Failed to read %s => %s", name, err.Error())
+			}
+		case path.Dir(name) == snapshotTablesDir && strings.HasSuffix(name, ".ndjson"):
+			table := strings.TrimSuffix(path.Base(name), ".ndjson")
+			if !tables[table] {
+				slog.Warn("skipping unknown table in snapshot", "file", name)
+				continue
+			}
+			if s.Tables[table], err = readNDJSON(tr); err != nil {
+				return nil, fmt.Errorf("Failed to read %s => %s", name, err.Error())
+			}
+		default:
+			slog.Warn("skipping unknown file in snapshot", "file", name)
+		}
+	}
+
+	if !foundManifest {
+		return nil, fmt.Errorf("snapshot has no %s", snapshotManifestFile)
+	}
+	if _, err := ParseTerm(s.Manifest.Term); err != nil {
+		return nil, fmt.Errorf("snapshot manifest => %s", err.Error())
+	}
+	for _, t := range snapshotTables {
+		if n := len(s.Tables[t.Name]); n != s.Manifest.Rows[t.Name] {
+			return nil, fmt.Errorf("snapshot has %d rows of %s, its manifest lists %d", n, t.Name, s.Manifest.Rows[t.Name])
+		}
+	}
+	if n := len(s.Documents); n != s.Manifest.Documents {
+		return nil, fmt.Errorf("snapshot has %d ES documents, its manifest lists %d", n, s.Manifest.Documents)
+	}
+	return s, nil
+}
+
+func readNDJSON(r io.Reader) ([]json.RawMessage, error) {
+	var lines []json.RawMessage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // descriptions make for long lines
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("invalid JSON on line %d", len(lines)+1)
+		}
+		lines = append(lines, json.RawMessage(append([]byte(nil), line...)))
+	}
+	return lines, scanner.Err()
+}
+
+// restoreSnapshot() replaces the term's rows with the snapshot's in a single
+// transaction, then extracts the requisites of the restored descriptions so
+// the tables match the restored ES documents
+func restoreSnapshot(ctx context.Context, db *sql.DB, s *termSnapshot) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	// clear in reverse so rows are deleted before those they reference
+	for i := len(snapshotTables) - 1; i >= 0; i-- {
+		t := snapshotTables[i]
+		if t.Clear == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, t.Clear, s.Manifest.Term); err != nil {
+			return fmt.Errorf("Failed to clear %s of %s => %s", t.Name, s.Manifest.Term, err.Error())
+		}
+	}
+
+	for _, t := range snapshotTables {
+		for i, row := range s.Tables[t.Name] {
+			if _, err := tx.ExecContext(ctx, t.Restore, string(row)); err != nil {
+				return fmt.Errorf("Failed to restore row %d of %s => %s", i+1, t.Name, err.Error())
+			}
+		}
+		slog.Info("restored table", "table", t.Name, "term", s.Manifest.Term, "rows", len(s.Tables[t.Name]))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit snapshot of %s => %s", s.Manifest.Term, err.Error())
+	}
+	return updateRequisites(ctx, db)
+}
+
+// snapshotBulkItems() indexes each document under its 'Course'
+func snapshotBulkItems(docs []json.RawMessage) (bulkInsert, error) {
+	items := make(bulkInsert, len(docs))
+	for i, doc := range docs {
+		var id struct{ Course string }
+		if err := json.Unmarshal(doc, &id); err != nil || id.Course == "" {
+			return nil, fmt.Errorf("ES document %d has no Course", i+1)
+		}
+		items[i] = newBulkItem(id.Course, doc)
+	}
+	return items, nil
+}
+
+// restoreDocuments() indexes the snapshot's documents as they were exported,
+// replacing those of the same courses
+func restoreDocuments(ctx context.Context, docs []json.RawMessage) error {
+	items, err := snapshotBulkItems(docs)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(items); start += batchSize {
+		end := start + batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		slog.Info("inserting ES batch", "items", end-start)
+		if err := insertEsData(ctx, items[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotCmd() exports a term to, or restores a term from, a snapshot archive
+func snapshotCmd(ctx context.Context, args []string) error {
+	usage := fmt.Errorf("usage: snapshot export -term 20143 [-out FILE] | snapshot restore -in FILE [-skip-es]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	flags := flag.NewFlagSet("snapshot "+args[0], flag.ExitOnError)
+	term := flags.String("term", "", "Term to export, EX: 20143")
+	out := flags.String("out", "", "File to write the snapshot to, defaults to TERM.tar.gz")
+	in := flags.String("in", "", "Snapshot file to restore")
+	skipES := flags.Bool("skip-es", false, "Skip restoring the ES documents")
+	flags.Parse(args[1:])
+
+	switch args[0] {
+	case "export":
+		if _, err := ParseTerm(*term); err != nil {
+			return err
+		}
+		if *out == "" {
+			*out = *term + ".tar.gz"
+		}
+
+		db := connectPG()
+		defer db.Close()
+
+		s, err := exportSnapshot(ctx, db, *term, time.Now())
+		if err != nil {
+			return err
+		}
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("Failed to create file, %s, with error: %s", *out, err.Error())
+		}
+		if err := s.write(file); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("Failed to write %s => %s", *out, err.Error())
+		}
+		slog.Info("exported snapshot", "term", *term, "file", *out, "rows", s.Manifest.Rows, "documents", s.Manifest.Documents)
+		return nil
+
+	case "restore":
+		if *in == "" {
+			return fmt.Errorf("-in must be set")
+		}
+		file, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("Failed to open file, %s, with error: %s", *in, err.Error())
+		}
+		s, err := readSnapshot(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		db := connectPG()
+		defer db.Close()
+
+		if err := restoreSnapshot(ctx, db, s); err != nil {
+			return err
+		}
+		if *skipES {
+			return nil
+		}
+		return restoreDocuments(ctx, s.Documents)
+	}
+	return usage
+}
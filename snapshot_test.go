@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func testSnapshot() *termSnapshot {
+	doc, _ := json.Marshal(testEsData)
+	s := &termSnapshot{
+		Manifest: snapshotManifest{Term: "20143", ExportedAt: testStarted, Rows: make(map[string]int)},
+		Tables: map[string][]json.RawMessage{
+			"sections_v2_t": {
+				json.RawMessage(`{"callnumber":13704,"term":"20143","course":"ACTU4850","starttime1":"20:10:00"}`),
+				json.RawMessage(`{"callnumber":13705,"term":"20143","course":"ACTU4850","starttime1":null}`),
+			},
+			"section_instructors_t": {
+				json.RawMessage(`{"term":"20143","callnumber":13704,"position":1,"canonical":"john vitucci"}`),
+			},
+		},
+		Documents: []json.RawMessage{doc},
+	}
+	for _, t := range snapshotTables {
+		s.Manifest.Rows[t.Name] = len(s.Tables[t.Name])
+	}
+	s.Manifest.Documents = len(s.Documents)
+	return s
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	s := testSnapshot()
+	var buf bytes.Buffer
+	if err := s.write(&buf); err != nil {
+		t.Fatalf("Failed to write snapshot => %s", err.Error())
+	}
+
+	read, err := readSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot => %s", err.Error())
+	}
+	if read.Manifest.Term != "20143" || !read.Manifest.ExportedAt.Equal(testStarted) {
+		t.Errorf("Expected the manifest to round trip, found %#v", read.Manifest)
+	}
+	for _, table := range snapshotTables {
+		if len(read.Tables[table.Name]) != len(s.Tables[table.Name]) {
+			t.Errorf("Expected %d rows of %s, found %d", len(s.Tables[table.Name]), table.Name, len(read.Tables[table.Name]))
+		}
+	}
+	if got := string(read.Tables["sections_v2_t"][0]); got != string(s.Tables["sections_v2_t"][0]) {
+		t.Errorf("Expected rows to be read as written, found %s", got)
+	}
+	if len(read.Documents) != 1 || string(read.Documents[0]) != string(s.Documents[0]) {
+		t.Errorf("Expected the ES document to be read as written, found %s", read.Documents)
+	}
+}
+
+func TestReadSnapshotChecksManifest(t *testing.T) {
+	s := testSnapshot()
+	s.Manifest.Rows["sections_v2_t"] = 3
+	var buf bytes.Buffer
+	if err := s.write(&buf); err != nil {
+		t.Fatalf("Failed to write snapshot => %s", err.Error())
+	}
+	if _, err := readSnapshot(&buf); err == nil || !strings.Contains(err.Error(), "sections_v2_t") {
+		t.Errorf("Expected an error for missing rows of sections_v2_t, found %v", err)
+	}
+
+	if _, err := readSnapshot(strings.NewReader("not a tarball")); err == nil {
+		t.Error("Expected an error for a file that is not a snapshot")
+	}
+}
+
+func TestSnapshotBulkItems(t *testing.T) {
+	items, err := snapshotBulkItems(testSnapshot().Documents)
+	if err != nil {
+		t.Fatalf("Failed to build bulk items => %s", err.Error())
+	}
+	if len(items) != 1 || items[0].Index.Index.ID != "test" || items[0].Index.Index.Type != esType {
+		t.Errorf("Expected the document to be indexed under its Course, found %#v", items)
+	}
+
+	body, err := items.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to encode bulk items => %s", err.Error())
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 2 || lines[1] != string(testSnapshot().Documents[0]) {
+		t.Errorf("Expected the exported document to be indexed unchanged, found %q", body)
+	}
+
+	if _, err := snapshotBulkItems([]json.RawMessage{json.RawMessage(`{"CourseFull":"COMSW4118"}`)}); err == nil {
+		t.Error("Expected an error for a document with no Course")
+	}
+}
+
+func TestRestoreSnapshotRequisites(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := testSnapshot()
+	mock.ExpectBegin()
+	for i := len(snapshotTables) - 1; i >= 0; i-- {
+		if snapshotTables[i].Clear != "" {
+			mock.ExpectExec(`DELETE FROM ` + snapshotTables[i].Name).WithArgs("20143").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+	for _, table := range snapshotTables {
+		for range s.Tables[table.Name] {
+			mock.ExpectExec(`INSERT INTO ` + table.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+	}
+	mock.ExpectCommit()
+
+	// the requisites are extracted from the restored descriptions
+	mock.ExpectQuery(`SELECT course, coalesce\(description, ''\) FROM courses_v2_t`).
+		WillReturnRows(sqlmock.NewRows([]string{"course", "description"}).AddRow("ACTU4850", "Prerequisites: ACTU K4810."))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM prerequisites_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM cross_listings_t`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO prerequisites_t`).
+		WithArgs("ACTU4850", "ACTU K4810", `{"Course":"ACTU4810"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := restoreSnapshot(context.Background(), db, s); err != nil {
+		t.Fatalf("Failed to restore snapshot => %s", err.Error())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
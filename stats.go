@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counter is one of the things a load counts
+type counter int
+
+const (
+	parsedRecords   counter = iota // courses decoded from the file
+	rejectedRecords                // courses skipped as invalid
+	insertedSections
+	updatedSections
+	failedRecords // courses with a failed database write
+	scrapedDescriptions
+	scrapeFailures
+	changeEvents
+	esIndexed
+	esFailed
+	numCounters
+)
+
+// names of the counters in the summary and metrics
+var counterNames = [numCounters]string{
+	"parsed",
+	"rejected",
+	"inserted",
+	"updated",
+	"failed",
+	"scraped",
+	"scrape_failed",
+	"change_events",
+	"es_indexed",
+	"es_failed",
+}
+
+// stageTiming is how long a stage of the load ran
+type stageTiming struct {
+	Stage    string
+	Duration time.Duration
+}
+
+// runStats collects the counts and stage durations of a load. Its methods may
+// be called from any stage, and do nothing on a nil *runStats.
+type runStats struct {
+	started time.Time
+	counts  [numCounters]atomic.Int64
+
+	mu     sync.Mutex
+	stages []stageTiming
+}
+
+func newRunStats(started time.Time) *runStats {
+	return &runStats{started: started}
+}
+
+// add() counts 'n' more of 'c'
+func (s *runStats) add(c counter, n int64) {
+	if s != nil {
+		s.counts[c].Add(n)
+	}
+}
+
+func (s *runStats) get(c counter) int64 {
+	if s == nil {
+		return 0
+	}
+	return s.counts[c].Load()
+}
+
+// stage() runs 'f', recording how long it took as the named stage
+func (s *runStats) stage(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	if s != nil {
+		s.mu.Lock()
+		s.stages = append(s.stages, stageTiming{Stage: name, Duration: time.Since(start)})
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *runStats) timings() []stageTiming {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stageTiming(nil), s.stages...)
+}
+
+// logSummary() logs a single structured line summing up the load
+func (s *runStats) logSummary(now time.Time, err error) {
+	counts := make([]interface{}, 0, numCounters)
+	for c := counter(0); c < numCounters; c++ {
+		counts = append(counts, slog.Int64(counterNames[c], s.get(c)))
+	}
+	durations := make([]interface{}, 0)
+	for _, t := range s.timings() {
+		durations = append(durations, slog.Float64(t.Stage, t.Duration.Seconds()))
+	}
+
+	attrs := []interface{}{
+		slog.Bool("success", err == nil),
+		slog.Float64("duration_seconds", now.Sub(s.started).Seconds()),
+		slog.Group("records", counts...),
+		slog.Group("stage_seconds", durations...),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.Info("run summary", attrs...)
+}
+
+// writeMetrics() writes the load's metrics in the Prometheus text format, as
+// read by the node_exporter textfile collector or a pushgateway
+func (s *runStats) writeMetrics(w io.Writer, now time.Time, err error) error {
+	success := 1
+	if err != nil {
+		success = 0
+	}
+
+	p := &metricsPrinter{w: w}
+	p.metric("dataupdates_load_success", "Whether the last load succeeded.")
+	p.printf("dataupdates_load_success %d\n", success)
+	p.metric("dataupdates_load_timestamp_seconds", "When the last load finished.")
+	p.printf("dataupdates_load_timestamp_seconds %d\n", now.Unix())
+	p.metric("dataupdates_load_duration_seconds", "How long the last load ran.")
+	p.printf("dataupdates_load_duration_seconds %g\n", now.Sub(s.started).Seconds())
+
+	p.metric("dataupdates_load_records", "Records handled by the last load, by outcome.")
+	for c := counter(0); c < numCounters; c++ {
+		p.printf("dataupdates_load_records{outcome=%q} %d\n", counterNames[c], s.get(c))
+	}
+	p.metric("dataupdates_load_stage_duration_seconds", "How long each stage of the last load ran.")
+	for _, t := range s.timings() {
+		p.printf("dataupdates_load_stage_duration_seconds{stage=%q} %g\n", t.Stage, t.Duration.Seconds())
+	}
+	return p.err
+}
+
+// writeMetricsFile() replaces 'filename' with the load's metrics. The file is
+// renamed into place so the collector never reads half of it.
+func (s *runStats) writeMetricsFile(filename string, now time.Time, err error) error {
+	tmp, tmpErr := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if tmpErr != nil {
+		return fmt.Errorf("Failed to create metrics file => %s", tmpErr.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if werr := s.writeMetrics(tmp, now, err); werr != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write metrics file => %s", werr.Error())
+	}
+	if cerr := tmp.Close(); cerr != nil {
+		return fmt.Errorf("Failed to write metrics file => %s", cerr.Error())
+	}
+	// CreateTemp makes the file private, the collector may run as another user
+	if cerr := os.Chmod(tmp.Name(), 0644); cerr != nil {
+		return fmt.Errorf("Failed to write metrics file => %s", cerr.Error())
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// metricsPrinter writes Prometheus text, keeping the first error
+type metricsPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *metricsPrinter) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+// metric() writes the HELP and TYPE lines of a gauge
+func (p *metricsPrinter) metric(name, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// setupLogging() makes the default logger, and so the log package, write
+// structured lines in the given format
+func setupLogging(w io.Writer, format string) error {
+	var h slog.Handler
+	switch format {
+	case "json":
+		h = slog.NewJSONHandler(w, nil)
+	case "text":
+		h = slog.NewTextHandler(w, nil)
+	default:
+		return fmt.Errorf("unknown log format, %s", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
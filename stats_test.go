@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStarted = time.Date(2014, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func testRunStats() *runStats {
+	s := newRunStats(testStarted)
+	s.add(parsedRecords, 10)
+	s.add(rejectedRecords, 1)
+	s.add(insertedSections, 6)
+	s.add(updatedSections, 3)
+	s.add(esIndexed, 9)
+	s.stage("parse", func() error { return nil })
+	return s
+}
+
+func TestRunStatsNil(t *testing.T) {
+	var s *runStats
+	s.add(parsedRecords, 1)
+	if s.get(parsedRecords) != 0 {
+		t.Error("Expected nil stats to count nothing")
+	}
+	called := false
+	if err := s.stage("parse", func() error { called = true; return errors.New("boom") }); err == nil || !called {
+		t.Error("Expected nil stats to still run the stage and return its error")
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	finished := testStarted.Add(90 * time.Second)
+	if err := testRunStats().writeMetrics(&buf, finished, nil); err != nil {
+		t.Fatal(err)
+	}
+	metrics := buf.String()
+	for _, line := range []string{
+		"# TYPE dataupdates_load_success gauge\n",
+		"dataupdates_load_success 1\n",
+		"dataupdates_load_duration_seconds 90\n",
+		`dataupdates_load_records{outcome="parsed"} 10` + "\n",
+		`dataupdates_load_records{outcome="updated"} 3` + "\n",
+		`dataupdates_load_records{outcome="es_failed"} 0` + "\n",
+		`dataupdates_load_stage_duration_seconds{stage="parse"} `,
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("Expected metrics to contain %q, found:\n%s", line, metrics)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "dataupdates.prom")
+	if err := testRunStats().writeMetricsFile(filename, finished, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filename)
+	if err != nil || !strings.Contains(string(b), "dataupdates_load_success 0\n") {
+		t.Errorf("Expected a failed run in the metrics file, found %s %v", b, err)
+	}
+}
+
+func TestLogSummary(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var buf bytes.Buffer
+	if err := setupLogging(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	testRunStats().logSummary(testStarted.Add(time.Minute), nil)
+
+	var line struct {
+		Msg     string
+		Success bool
+		Records map[string]int64
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON summary line, found %s", buf.String())
+	}
+	if line.Msg != "run summary" || !line.Success || line.Records["inserted"] != 6 || line.Records["rejected"] != 1 {
+		t.Errorf("Unexpected summary, %s", buf.String())
+	}
+
+	if err := setupLogging(&buf, "xml"); err == nil {
+		t.Error("Expected an unknown log format to fail")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CourseStore writes the course and section rows of each loaded Course
+type CourseStore interface {
+	// InsertCourse appends the course to 'courses_t'
+	InsertCourse(ctx context.Context, c Course) error
+	// UpsertCourse writes the canonical course to 'courses_v2_t', keeping a
+	// stored course from a later term
+	UpsertCourse(ctx context.Context, c Course) error
+	// UpsertCourseTerm writes the course's row for its term to 'course_terms_t'
+	UpsertCourseTerm(ctx context.Context, c Course) error
+	// UpsertSection writes the section to 'sections_v2_t', restoring it if it
+	// was cancelled. 'inserted' is false for an update.
+	UpsertSection(ctx context.Context, c Course) (inserted bool, err error)
+}
+
+// storeTable is a table written from a Course. Its columns are the Course
+// fields whose `tables` tag lists its Group.
+type storeTable struct {
+	Name      string   // EX: sections_v2_t
+	Group     string   // EX: sections
+	Key       []string // the columns a row is unique on, none for a log of rows
+	NewerTerm bool     // only replace a row with one from the same or a later term
+	Reset     []string // columns set to NULL when a row is replaced
+}
+
+var (
+	legacyCoursesTable = storeTable{Name: "courses_t", Group: "legacy"}
+	coursesTable       = storeTable{Name: "courses_v2_t", Group: "courses", Key: []string{"course"}, NewerTerm: true}
+	courseTermsTable   = storeTable{Name: "course_terms_t", Group: "courses", Key: []string{"course", "term"}}
+	sectionsTable      = storeTable{Name: "sections_v2_t", Group: "sections", Key: []string{"term", "callnumber"}, Reset: []string{"cancelled_at"}}
+
+	storeTables = []storeTable{legacyCoursesTable, coursesTable, courseTermsTable, sectionsTable}
+)
+
+// storeColumn is a column and the Course field it is read from
+type storeColumn struct {
+	Name  string
+	Index []int // as used by reflect.Value.FieldByIndex
+	Int   bool  // an integer column, tagged `type:"int"`
+}
+
+// taggedColumns() lists the fields of 't', and of the structs it embeds, that
+// are stored in the group's tables
+func taggedColumns(t reflect.Type, group string, index []int) []storeColumn {
+	var columns []storeColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			columns = append(columns, taggedColumns(f.Type, group, fieldIndex)...)
+			continue
+		}
+
+		name := f.Tag.Get("db")
+		if name == "" {
+			continue
+		}
+		for _, g := range strings.Split(f.Tag.Get("tables"), ",") {
+			if g == group {
+				columns = append(columns, storeColumn{Name: name, Index: fieldIndex, Int: f.Tag.Get("type") == "int"})
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// columns of each group of tables, read once from the Course tags
+var groupColumns = func() map[string][]storeColumn {
+	groups := make(map[string][]storeColumn)
+	for _, t := range storeTables {
+		groups[t.Group] = taggedColumns(reflect.TypeOf(Course{}), t.Group, nil)
+	}
+	return groups
+}()
+
+func (t storeTable) columns() []storeColumn {
+	return groupColumns[t.Group]
+}
+
+func (t storeTable) columnNames() []string {
+	names := make([]string, 0, len(t.columns()))
+	for _, c := range t.columns() {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// values() reads the table's columns from 'c', in order
+func (t storeTable) values(c Course) []interface{} {
+	v := reflect.ValueOf(c)
+	values := make([]interface{}, 0, len(t.columns()))
+	for _, col := range t.columns() {
+		values = append(values, v.FieldByIndex(col.Index).Interface())
+	}
+	return values
+}
+
+// valueColumns() are the columns replaced by an upsert, those not in the key
+func (t storeTable) valueColumns() []string {
+	var names []string
+	for _, name := range t.columnNames() {
+		isKey := false
+		for _, k := range t.Key {
+			isKey = isKey || k == name
+		}
+		if !isKey {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// insertQuery() inserts a row, numbering its values with 'placeholder'
+func (t storeTable) insertQuery(placeholder func(n int) string) string {
+	names := t.columnNames()
+	params := make([]string, len(names))
+	for i := range names {
+		params[i] = placeholder(i + 1)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.Name, strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+// upsertQuery() inserts a row or replaces the row with the same key. Postgres
+// and SQLite share the syntax.
+func (t storeTable) upsertQuery(placeholder func(n int) string) string {
+	set := []string{excludedColumns(t.valueColumns())}
+	for _, name := range t.Reset {
+		set = append(set, name+" = NULL")
+	}
+
+	query := fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s",
+		t.insertQuery(placeholder), strings.Join(t.Key, ", "), strings.Join(set, ", "))
+	if t.NewerTerm {
+		query += fmt.Sprintf(" WHERE %[1]s.term IS NULL OR %[1]s.term <= EXCLUDED.term", t.Name)
+	}
+	return query
+}
+
+// excludedColumns() sets each column to the value proposed for insertion
+func excludedColumns(columns []string) string {
+	set := make([]string, len(columns))
+	for i, c := range columns {
+		set[i] = fmt.Sprintf("%[1]s = EXCLUDED.%[1]s", c)
+	}
+	return strings.Join(set, ", ")
+}
+
+// pgPlaceholder() numbers parameters as Postgres expects, EX: $1
+func pgPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// sqlCourseStore writes courses with generated SQL, and is shared by the
+// Postgres and SQLite stores
+type sqlCourseStore struct {
+	db          *sql.DB
+	placeholder func(n int) string
+}
+
+func (s sqlCourseStore) exec(ctx context.Context, t storeTable, query string, c Course) error {
+	if _, err := s.db.ExecContext(ctx, query, t.values(c)...); err != nil {
+		return fmt.Errorf("Failed to insert %s, %s %s, => %s", t.Name, c.Term, c.Course, err.Error())
+	}
+	return nil
+}
+
+func (s sqlCourseStore) InsertCourse(ctx context.Context, c Course) error {
+	return s.exec(ctx, legacyCoursesTable, legacyCoursesTable.insertQuery(s.placeholder), c)
+}
+
+func (s sqlCourseStore) UpsertCourse(ctx context.Context, c Course) error {
+	return s.exec(ctx, coursesTable, coursesTable.upsertQuery(s.placeholder), c)
+}
+
+func (s sqlCourseStore) UpsertCourseTerm(ctx context.Context, c Course) error {
+	return s.exec(ctx, courseTermsTable, courseTermsTable.upsertQuery(s.placeholder), c)
+}
+
+// pgCourseStore writes courses to Postgres
+type pgCourseStore struct {
+	sqlCourseStore
+}
+
+func newPGCourseStore(db *sql.DB) *pgCourseStore {
+	return &pgCourseStore{sqlCourseStore{db: db, placeholder: pgPlaceholder}}
+}
+
+func (s *pgCourseStore) UpsertSection(ctx context.Context, c Course) (inserted bool, err error) {
+	query := sectionsTable.upsertQuery(s.placeholder) +
+		" RETURNING (xmax = 0)" // a row that was never updated is a new insert
+	err = s.db.QueryRowContext(ctx, query, sectionsTable.values(c)...).Scan(&inserted)
+	if err != nil {
+		return false, fmt.Errorf("Failed to insert sections_v2_t, %s %s, => %s", c.Term, c.CallNumber, err.Error())
+	}
+	return inserted, nil
+}
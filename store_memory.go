@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// storeRow is a row of a table, by column
+type storeRow map[string]interface{}
+
+// memoryCourseStore keeps the rows of each table in memory, for tests and dry
+// runs
+type memoryCourseStore struct {
+	mu     sync.Mutex
+	keyed  map[string]map[string]storeRow // table --> key --> row
+	logged map[string][]storeRow          // rows of tables without a key
+}
+
+func newMemoryCourseStore() *memoryCourseStore {
+	return &memoryCourseStore{
+		keyed:  make(map[string]map[string]storeRow),
+		logged: make(map[string][]storeRow),
+	}
+}
+
+func (t storeTable) row(c Course) storeRow {
+	row := make(storeRow)
+	values := t.values(c)
+	for i, name := range t.columnNames() {
+		row[name] = values[i]
+	}
+	return row
+}
+
+// write() stores the row, returning true if it did not replace one
+func (s *memoryCourseStore) write(t storeTable, c Course) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row := t.row(c)
+	if len(t.Key) == 0 {
+		s.logged[t.Name] = append(s.logged[t.Name], row)
+		return true
+	}
+
+	var key []string
+	for _, k := range t.Key {
+		key = append(key, row[k].(string))
+	}
+	rows := s.keyed[t.Name]
+	if rows == nil {
+		rows = make(map[string]storeRow)
+		s.keyed[t.Name] = rows
+	}
+	old, ok := rows[strings.Join(key, "-")]
+	if ok && t.NewerTerm && old["term"].(string) > row["term"].(string) {
+		return false
+	}
+	rows[strings.Join(key, "-")] = row
+	return !ok
+}
+
+// rows() lists the rows of a table, in order of their keys for a keyed table
+func (s *memoryCourseStore) rows(table string) []storeRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if logged, ok := s.logged[table]; ok {
+		return append([]storeRow(nil), logged...)
+	}
+	keys := make([]string, 0, len(s.keyed[table]))
+	for k := range s.keyed[table] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([]storeRow, 0, len(keys))
+	for _, k := range keys {
+		rows = append(rows, s.keyed[table][k])
+	}
+	return rows
+}
+
+func (s *memoryCourseStore) InsertCourse(ctx context.Context, c Course) error {
+	s.write(legacyCoursesTable, c)
+	return ctx.Err()
+}
+
+func (s *memoryCourseStore) UpsertCourse(ctx context.Context, c Course) error {
+	s.write(coursesTable, c)
+	return ctx.Err()
+}
+
+func (s *memoryCourseStore) UpsertCourseTerm(ctx context.Context, c Course) error {
+	s.write(courseTermsTable, c)
+	return ctx.Err()
+}
+
+func (s *memoryCourseStore) UpsertSection(ctx context.Context, c Course) (bool, error) {
+	return s.write(sectionsTable, c), ctx.Err()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // register the sqlite3 driver w/ sql
+)
+
+// sqlitePlaceholder() numbers parameters as SQLite expects
+func sqlitePlaceholder(n int) string {
+	return "?"
+}
+
+// createQuery() creates the table in SQLite. Integer columns are declared
+// INTEGER so they compare and sort as numbers, as they do in Postgres.
+func (t storeTable) createQuery() string {
+	var defs []string
+	for _, col := range t.columns() {
+		typ := "TEXT"
+		if col.Int {
+			typ = "INTEGER"
+		}
+		defs = append(defs, col.Name+" "+typ)
+	}
+	for _, name := range t.Reset {
+		defs = append(defs, name+" TEXT")
+	}
+	if len(t.Key) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(t.Key, ", ")))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", t.Name, strings.Join(defs, ", "))
+}
+
+// sqliteCourseStore writes courses to a SQLite database
+type sqliteCourseStore struct {
+	sqlCourseStore
+}
+
+// newSQLiteCourseStore() creates any of the course tables missing from 'db'
+func newSQLiteCourseStore(ctx context.Context, db *sql.DB) (*sqliteCourseStore, error) {
+	for _, t := range storeTables {
+		if _, err := db.ExecContext(ctx, t.createQuery()); err != nil {
+			return nil, fmt.Errorf("Failed to create SQLite table %s => %s", t.Name, err.Error())
+		}
+	}
+	return &sqliteCourseStore{sqlCourseStore{db: db, placeholder: sqlitePlaceholder}}, nil
+}
+
+// UpsertSection checks for the section first, since SQLite cannot tell an
+// insert from an update
+func (s *sqliteCourseStore) UpsertSection(ctx context.Context, c Course) (inserted bool, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("Failed to begin transaction => %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	var n int
+	err = tx.QueryRowContext(ctx,
+		`SELECT count(*) FROM sections_v2_t WHERE term = ? AND callnumber = ?`, c.Term, c.CallNumber,
+	).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("Failed to query sections_v2_t, %s %s, => %s", c.Term, c.CallNumber, err.Error())
+	}
+	if _, err := tx.ExecContext(ctx, sectionsTable.upsertQuery(s.placeholder), sectionsTable.values(c)...); err != nil {
+		return false, fmt.Errorf("Failed to insert sections_v2_t, %s %s, => %s", c.Term, c.CallNumber, err.Error())
+	}
+	return n == 0, tx.Commit()
+}
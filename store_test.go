@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestStoreColumns(t *testing.T) {
+	counts := map[string]int{"courses_t": 50, "courses_v2_t": 23, "course_terms_t": 23, "sections_v2_t": 32}
+	for _, table := range storeTables {
+		if n := len(table.columnNames()); n != counts[table.Name] {
+			t.Errorf("Expected %d columns in %s, found %d: %v", counts[table.Name], table.Name, n, table.columnNames())
+		}
+	}
+
+	has := func(table storeTable, column string) bool {
+		for _, name := range table.columnNames() {
+			if name == column {
+				return true
+			}
+		}
+		return false
+	}
+	if has(legacyCoursesTable, "coursefull") || has(sectionsTable, "description") || has(coursesTable, "callnumber") {
+		t.Error("Expected columns only in the tables their tags list")
+	}
+	if !has(sectionsTable, "enrollmentstatus") || !has(legacyCoursesTable, "meetson1") || has(legacyCoursesTable, "meetson2") {
+		t.Error("Expected columns in every table their tags list")
+	}
+
+	values := sectionsTable.values(testSection)
+	for i, name := range sectionsTable.columnNames() {
+		if name == "callnumber" && values[i] != "13704" {
+			t.Errorf("Expected the section's call number, found %v", values[i])
+		}
+	}
+}
+
+func TestExcludedColumns(t *testing.T) {
+	expected := "globalcore = EXCLUDED.globalcore, corecurriculum = EXCLUDED.corecurriculum, " +
+		"writingintensive = EXCLUDED.writingintensive, labscience = EXCLUDED.labscience"
+	if set := excludedColumns(courseAttributeColumns()); set != expected {
+		t.Errorf("Expected %q, found %q", expected, set)
+	}
+}
+
+func TestUpsertQuery(t *testing.T) {
+	query := sectionsTable.upsertQuery(pgPlaceholder)
+	for _, s := range []string{
+		"INSERT INTO sections_v2_t (",
+		"$32)",
+		"ON CONFLICT (term, callnumber) DO UPDATE SET",
+		"course = EXCLUDED.course",
+		"cancelled_at = NULL",
+	} {
+		if !strings.Contains(query, s) {
+			t.Errorf("Expected %q in %s", s, query)
+		}
+	}
+	if strings.Contains(query, "term = EXCLUDED.term") || strings.Contains(query, "WHERE") {
+		t.Errorf("Expected the key to be left alone, found %s", query)
+	}
+
+	query = coursesTable.upsertQuery(sqlitePlaceholder)
+	if !strings.HasSuffix(query, "WHERE courses_v2_t.term IS NULL OR courses_v2_t.term <= EXCLUDED.term") {
+		t.Errorf("Expected a course to only be replaced from a later term, found %s", query)
+	}
+	if strings.Contains(query, "$") || strings.Count(query, "?") != 23 {
+		t.Errorf("Expected SQLite placeholders, found %s", query)
+	}
+}
+
+// testCourseStore() checks the behaviour shared by every CourseStore. 'row'
+// reads back a column of a stored row.
+func testCourseStore(t *testing.T, store CourseStore, row func(table, column, where string, args ...interface{}) string) {
+	ctx := context.Background()
+	c := testSection
+	c.Course, c.CourseFull, c.CourseTitle = "ACTUK4850K001", "ACTUK4850", "ORAL COMM FOR ACTUARIAL PROF"
+
+	if err := store.InsertCourse(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertCourse(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertCourseTerm(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{true, false} {
+		c.NumEnrolled = []string{"30", "29"}[i]
+		inserted, err := store.UpsertSection(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inserted != expected {
+			t.Errorf("Expected upsert %d to report inserted = %t", i+1, expected)
+		}
+	}
+	if n := row("sections_v2_t", "numenrolled", "term = ? AND callnumber = ?", "20143", "13704"); n != "29" {
+		t.Errorf("Expected the section to be updated, found %s enrolled", n)
+	}
+
+	// a course from an earlier term leaves the canonical course alone
+	older := c
+	older.Term, older.CourseTitle = "20141", "OLD TITLE"
+	if err := store.UpsertCourse(ctx, older); err != nil {
+		t.Fatal(err)
+	}
+	if title := row("courses_v2_t", "coursetitle", "course = ?", "ACTU4850"); title != "ORAL COMM FOR ACTUARIAL PROF" {
+		t.Errorf("Expected the later term's course to be kept, found %s", title)
+	}
+	if course := row("courses_t", "course", "callnumber = ?", "13704"); course != "ACTUK4850K001" {
+		t.Errorf("Expected the full course code in courses_t, found %s", course)
+	}
+}
+
+func TestSQLiteCourseStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // each connection opens its own in-memory database
+
+	store, err := newSQLiteCourseStore(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Failed to create the SQLite store => %s", err.Error())
+	}
+	testCourseStore(t, store, func(table, column, where string, args ...interface{}) string {
+		var v string
+		if err := db.QueryRow("SELECT "+column+" FROM "+table+" WHERE "+where, args...).Scan(&v); err != nil {
+			t.Fatalf("Failed to read %s.%s => %s", table, column, err.Error())
+		}
+		return v
+	})
+
+	// integer columns compare as numbers, not text where '30' < '5'
+	var typ string
+	if err := db.QueryRow(`SELECT typeof(maxsize) FROM sections_v2_t WHERE maxsize > 5 ORDER BY numenrolled`).Scan(&typ); err != nil {
+		t.Fatalf("Expected the section's size to compare as a number => %s", err.Error())
+	}
+	if typ != "integer" {
+		t.Errorf("Expected maxsize to be stored as an integer, found %s", typ)
+	}
+}
+
+func TestMemoryCourseStore(t *testing.T) {
+	store := newMemoryCourseStore()
+	testCourseStore(t, store, func(table, column, where string, args ...interface{}) string {
+		// every condition in the test is on columns equal to the args, in order
+		var columns []string
+		for _, cond := range strings.Split(where, " AND ") {
+			columns = append(columns, strings.TrimSuffix(cond, " = ?"))
+		}
+		for _, r := range store.rows(table) {
+			match := true
+			for i, col := range columns {
+				match = match && r[col] == args[i]
+			}
+			if match {
+				return r[column].(string)
+			}
+		}
+		t.Fatalf("Found no row of %s where %s %v", table, where, args)
+		return ""
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Semester is the last digit of a term code
+type Semester int
+
+// Semesters in the order they fall within a year
+const (
+	Spring Semester = 1
+	Summer Semester = 2
+	Fall   Semester = 3
+)
+
+func (s Semester) String() string {
+	switch s {
+	case Spring:
+		return "Spring"
+	case Summer:
+		return "Summer"
+	case Fall:
+		return "Fall"
+	}
+	return fmt.Sprintf("Semester(%d)", int(s))
+}
+
+// Term is a decoded term code, EX: "20143" => Fall 2014
+type Term struct {
+	Year     int
+	Semester Semester
+}
+
+// ParseTerm decodes a term code such as "20143"
+func ParseTerm(code string) (Term, error) {
+	if len(code) != 5 {
+		return Term{}, fmt.Errorf("term code must be a year and semester such as 20143, found %q", code)
+	}
+	year, err := strconv.Atoi(code[:4])
+	if err != nil {
+		return Term{}, fmt.Errorf("term code must be a year and semester such as 20143, found %q", code)
+	}
+	s := Semester(code[4] - '0')
+	if s < Spring || s > Fall {
+		return Term{}, fmt.Errorf("term code semester must be 1, 2 or 3, found %q", code)
+	}
+	return Term{Year: year, Semester: s}, nil
+}
+
+// Code is the term code, EX: 20143
+func (t Term) Code() string {
+	return fmt.Sprintf("%04d%d", t.Year, t.Semester)
+}
+
+// String is the term's name, EX: Fall 2014
+func (t Term) String() string {
+	return fmt.Sprintf("%s %d", t.Semester, t.Year)
+}
+
+// calendarDate is a date in the term calendar, EX: "2014-09-02"
+type calendarDate struct {
+	time.Time
+}
+
+func (d *calendarDate) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return fmt.Errorf("calendar dates must look like 2014-09-02, found %q", s)
+	}
+	d.Time = t
+	return nil
+}
+
+// dateRange is the first and last days of classes of a term or subterm
+type dateRange struct {
+	Start calendarDate
+	End   calendarDate
+}
+
+// termDates are the dates of a single term
+type termDates struct {
+	dateRange
+	Holidays []calendarDate
+	Subterms map[string]dateRange // by SubtermCode
+}
+
+// termCalendar holds the dates of each term by term code. It is read from a
+// JSON file such as:
+//
+//	{"20143": {"Start": "2014-09-02", "End": "2014-12-12",
+//	           "Holidays": ["2014-11-03", "2014-11-04"],
+//	           "Subterms": {"A": {"Start": "2014-09-02", "End": "2014-10-22"}}}}
+type termCalendar map[string]termDates
+
+// loadTermCalendar() reads a term calendar file
+func loadTermCalendar(filename string) (termCalendar, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file, %s, with error: %s", filename, err.Error())
+	}
+	defer file.Close()
+	return parseTermCalendar(file)
+}
+
+// parseTermCalendar() decodes and checks a term calendar
+func parseTermCalendar(r io.Reader) (termCalendar, error) {
+	var cal termCalendar
+	if err := json.NewDecoder(r).Decode(&cal); err != nil {
+		return nil, fmt.Errorf("Failed to decode term calendar => %s", err.Error())
+	}
+	for code, dates := range cal {
+		if _, err := ParseTerm(code); err != nil {
+			return nil, err
+		}
+		if dates.End.Before(dates.Start.Time) {
+			return nil, fmt.Errorf("%s ends before it starts", code)
+		}
+		for subterm, r := range dates.Subterms {
+			if r.End.Before(r.Start.Time) || r.Start.Before(dates.Start.Time) || r.End.After(dates.End.Time) {
+				return nil, fmt.Errorf("%s subterm %s must fall within the term", code, subterm)
+			}
+		}
+	}
+	return cal, nil
+}
+
+// bounds() are the days classes of the term, or of one of its subterms, are
+// held. An unknown subterm spans the whole term.
+func (c termCalendar) bounds(term, subterm string) (termBounds, error) {
+	dates, ok := c[term]
+	if !ok {
+		return termBounds{}, fmt.Errorf("no dates for term %s in the term calendar", term)
+	}
+	r := dates.dateRange
+	if s, ok := dates.Subterms[subterm]; ok {
+		r = s
+	}
+
+	b := termBounds{Start: r.Start.Time, End: r.End.Time}
+	for _, h := range dates.Holidays {
+		if !h.Before(b.Start) && !h.After(b.End) {
+			b.Holidays = append(b.Holidays, h.Time)
+		}
+	}
+	return b, nil
+}
+
+// current() is the term in session on the day of 'now', or else the next term
+// to start. It is false when every term has ended.
+func (c termCalendar) current(now time.Time) (string, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	codes := make([]string, 0, len(c))
+	for code := range c {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		if !c[code].End.Before(today) {
+			return code, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTermCalendar = func() termCalendar {
+	cal, err := parseTermCalendar(strings.NewReader(`{
+		"20143": {
+			"Start": "2014-09-03",
+			"End": "2014-12-12",
+			"Holidays": ["2014-11-03", "2014-11-04", "2014-11-27", "2014-11-28"],
+			"Subterms": {"A": {"Start": "2014-09-03", "End": "2014-10-22"}}
+		},
+		"20151": {"Start": "2015-01-20", "End": "2015-05-04"}
+	}`))
+	if err != nil {
+		panic(err)
+	}
+	return cal
+}()
+
+var termInputs = map[string]string{ // code --> name, "" when invalid
+	"20143": "Fall 2014",
+	"20151": "Spring 2015",
+	"20122": "Summer 2012",
+	"20144": "",
+	"2014":  "",
+	"Y2K13": "",
+}
+
+func TestParseTerm(t *testing.T) {
+	for code, name := range termInputs {
+		term, err := ParseTerm(code)
+		if name == "" {
+			if err == nil {
+				t.Errorf("Expected %q to be invalid, found %v", code, term)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to parse %q => %s", code, err.Error())
+			continue
+		}
+		if term.String() != name || term.Code() != code {
+			t.Errorf("Expected %q to be %s, found %s (%s)", code, name, term, term.Code())
+		}
+	}
+}
+
+func TestTermCalendarBounds(t *testing.T) {
+	b, err := testTermCalendar.bounds("20143", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.End.Format("2006-01-02") != "2014-10-22" || len(b.Holidays) != 0 {
+		t.Errorf("Expected the first half of the term without holidays, found %v", b)
+	}
+
+	b, err = testTermCalendar.bounds("20143", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.End.Format("2006-01-02") != "2014-12-12" || len(b.Holidays) != 4 {
+		t.Errorf("Expected the whole term with its holidays, found %v", b)
+	}
+
+	if _, err := testTermCalendar.bounds("20152", ""); err == nil {
+		t.Error("Expected a term missing from the calendar to fail")
+	}
+
+	_, err = parseTermCalendar(strings.NewReader(`{"20143": {"Start": "2014-09-03", "End": "2014-12-12",
+		"Subterms": {"B": {"Start": "2014-10-23", "End": "2014-12-20"}}}}`))
+	if err == nil {
+		t.Error("Expected a subterm ending after its term to be rejected")
+	}
+}
+
+var currentTermInputs = map[string]string{ // date --> current term
+	"2014-08-01": "20143",
+	"2014-12-12": "20143",
+	"2014-12-25": "20151",
+	"2015-03-01": "20151",
+	"2015-06-01": "",
+}
+
+func TestCurrentTerm(t *testing.T) {
+	for date, expected := range currentTermInputs {
+		now, _ := time.Parse("2006-01-02", date)
+		code, ok := testTermCalendar.current(now.Add(15 * time.Hour))
+		if code != expected || ok != (expected != "") {
+			t.Errorf("Expected %s to be in %q, found %q", date, expected, code)
+		}
+	}
+}